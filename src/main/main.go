@@ -4,11 +4,29 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"path/filepath"
 
 	"sawyer.com/v9/src/monkey/repl"
+	"sawyer.com/v9/src/monkey/vm"
 )
 
 func main() {
+	// monkey script.monkey runs the file like a module,
+	// its directory is searched first for the modules it imports
+	if len(os.Args) > 1 {
+		file, err := filepath.Abs(os.Args[1])
+		if err != nil {
+			panic(err)
+		}
+		vm.Modules.SearchPath = append([]string{filepath.Dir(file)}, vm.Modules.SearchPath...)
+		_, err = vm.Modules.Import(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -3,6 +3,9 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
 	"strings"
 
 	"sawyer.com/v9/src/monkey/token"
@@ -44,19 +47,42 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+// names of the top-level bindings marked with export
+func (p *Program) Exports() []string {
+	names := []string{}
+	for _, s := range p.Statements {
+		if ls, ok := s.(*LetStatement); ok && ls.Export {
+			names = append(names, ls.Name.Value)
+		}
+	}
+	return names
+}
+
 // LetSatement is a Statement
+// const bindings share the same node, e.g. const x = 1;
 type LetStatement struct {
-	Token token.Token // the token.LET
-	Name  *Identifier
-	Value Expression
+	Token  token.Token // the token.LET or token.CONST
+	Name   *Identifier
+	Type   TypeExpression // nil when the binding isn't annotated, let n: int = 1
+	Value  Expression
+	Const  bool // the binding can't be redefined in its scope
+	Export bool // the binding is visible to modules importing this one
+	// a function in the value refers to the binding, {"f": fn() { h.x }}
+	Captured bool
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
+	if ls.Export {
+		out.WriteString("export ")
+	}
 	out.WriteString(ls.TokenLiteral() + " ")
 	out.WriteString(ls.Name.String())
+	if ls.Type != nil {
+		out.WriteString(": " + ls.Type.String())
+	}
 	out.WriteString(" = ")
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
@@ -65,6 +91,176 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// ThrowStatement is a Statement
+type ThrowStatement struct {
+	Token token.Token // the 'throw' token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
+// DeferStatement is a Statement
+// defer close(f); the call runs when the function it's in returns
+type DeferStatement struct {
+	Token token.Token // the 'defer' token
+	Call  *CallExpression
+}
+
+func (ds *DeferStatement) statementNode()       {}
+func (ds *DeferStatement) TokenLiteral() string { return ds.Token.Literal }
+func (ds *DeferStatement) String() string {
+	return ds.TokenLiteral() + " " + ds.Call.String() + ";"
+}
+
+// ForStatement is a Statement
+// for (x in xs) { puts(x) }, for (k, v in h) { ... }
+type ForStatement struct {
+	Token token.Token // the 'for' token
+	ComprehensionClause
+	Body *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) String() string {
+	vars := []string{}
+	for _, v := range fs.Variables {
+		vars = append(vars, v.String())
+	}
+	return "for (" + strings.Join(vars, ", ") + " in " + fs.Iterable.String() + ") " + fs.Body.String()
+}
+
+// StructStatement is a Statement
+// struct Point { x, y }
+type StructStatement struct {
+	Token  token.Token // the token.STRUCT
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) String() string {
+	fields := []string{}
+	for _, f := range ss.Fields {
+		fields = append(fields, f.String())
+	}
+	return "struct " + ss.Name.String() + " { " + strings.Join(fields, ", ") + " }"
+}
+
+// EnumStatement is a Statement
+// enum Status { Pending, Done(result), Failed(reason) }
+type EnumStatement struct {
+	Token    token.Token // the token.ENUM
+	Name     *Identifier
+	Variants []*EnumVariant
+}
+
+// EnumVariant is a variant of an enum declaration, Fields is empty for Pending
+type EnumVariant struct {
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (es *EnumStatement) statementNode()       {}
+func (es *EnumStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *EnumStatement) String() string {
+	variants := []string{}
+	for _, v := range es.Variants {
+		if len(v.Fields) == 0 {
+			variants = append(variants, v.Name.String())
+			continue
+		}
+		fields := []string{}
+		for _, f := range v.Fields {
+			fields = append(fields, f.String())
+		}
+		variants = append(variants, v.Name.String()+"("+strings.Join(fields, ", ")+")")
+	}
+	return "enum " + es.Name.String() + " { " + strings.Join(variants, ", ") + " }"
+}
+
+// YieldExpression is an Expression
+// yield x pauses the generator, it evaluates to what the next next() sends
+type YieldExpression struct {
+	Token token.Token // the token.YIELD
+	Value Expression  // nil for a bare yield
+	// yield* g yields what the generator g yields, and evaluates to what g returns
+	Delegate bool
+}
+
+func (ye *YieldExpression) expressionNode()      {}
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) String() string {
+	if ye.Value == nil {
+		return "yield"
+	}
+	if ye.Delegate {
+		return "yield* " + ye.Value.String()
+	}
+	return "yield " + ye.Value.String()
+}
+
+// ClassStatement is a Statement
+// class Dog extends Animal { init(name) { self.name = name } speak() { "woof" } }
+type ClassStatement struct {
+	Token   token.Token // the token.CLASS
+	Name    *Identifier
+	Super   *Identifier // nil without extends
+	Methods []*Method
+}
+
+// Method is a function defined in a class body, it gets self as a hidden first parameter
+type Method struct {
+	Name     *Identifier
+	Function *FunctionLiteral
+}
+
+func (cs *ClassStatement) statementNode()       {}
+func (cs *ClassStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ClassStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("class " + cs.Name.String())
+	if cs.Super != nil {
+		out.WriteString(" extends " + cs.Super.String())
+	}
+	out.WriteString(" { ")
+	for _, m := range cs.Methods {
+		out.WriteString(m.Name.String() + m.Function.signature() + m.Function.Body.String() + " ")
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// SuperExpression is an Expression
+// super.init(name), the method of the superclass, bound to self
+type SuperExpression struct {
+	Token  token.Token // the token.SUPER
+	Method *Identifier
+}
+
+func (se *SuperExpression) expressionNode()      {}
+func (se *SuperExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SuperExpression) String() string       { return "super." + se.Method.String() }
+
+// ImportStatement is a Statement
+// import "lib/strings.monkey" as s;
+type ImportStatement struct {
+	Token token.Token // the token.IMPORT
+	Path  string      // as written, resolved against the search path
+	Name  *Identifier // the module is bound to it
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	return is.TokenLiteral() + " " + strconv.Quote(is.Path) + " as " + is.Name.String() + ";"
+}
+
 // ReturnStatement is a Statement
 type ReturnStatement struct {
 	Token       token.Token // the 'return' token
@@ -115,6 +311,8 @@ func (i *Identifier) String() string       { return i.Value }
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64 // special type
+	// the value when it doesn't fit in an int64, Value is 0 then
+	Big *big.Int
 }
 
 func (il *IntegerLiteral) expressionNode()      {}
@@ -160,6 +358,32 @@ func (oe *InfixExpression) String() string {
 	return out.String()
 }
 
+// range is an expression
+// e.g. 0..n, 1..=n, 0..n step 2
+type RangeExpression struct {
+	Token     token.Token // the .. or ..= token
+	Start     Expression
+	End       Expression
+	Step      Expression // nil when it's left out
+	Inclusive bool       // ..=
+}
+
+func (re *RangeExpression) expressionNode()      {}
+func (re *RangeExpression) TokenLiteral() string { return re.Token.Literal }
+func (re *RangeExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(re.Start.String())
+	out.WriteString(re.Token.Literal)
+	out.WriteString(re.End.String())
+	if re.Step != nil {
+		out.WriteString(" step ")
+		out.WriteString(re.Step.String())
+	}
+	out.WriteString(")")
+	return out.String()
+}
+
 // Boolean is an expression
 type Boolean struct {
 	Token token.Token
@@ -192,6 +416,37 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// TryExpression is an expression, its value is the one of the try block,
+// or of the catch block when something was thrown
+// try { } catch (e) { } finally { }
+type TryExpression struct {
+	Token   token.Token // the 'try' token
+	Block   *BlockStatement
+	Param   *Identifier     // the thrown value is bound to it, may be nil
+	Catch   *BlockStatement // at least one of Catch
+	Finally *BlockStatement // and Finally is set
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+	if te.Catch != nil {
+		out.WriteString(" catch ")
+		if te.Param != nil {
+			out.WriteString("(" + te.Param.String() + ") ")
+		}
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+	return out.String()
+}
+
 // BlockStatement is a statement
 type BlockStatement struct {
 	Token      token.Token // the { token
@@ -212,32 +467,147 @@ func (bs *BlockStatement) String() string {
 type FunctionLiteral struct {
 	Token      token.Token // The 'fn' token
 	Parameters []*Identifier
-	Body       *BlockStatement
-	Name       string
+	// the annotations of the parameters, by position, nil for one without.
+	// it's shorter than Parameters when the last ones aren't annotated
+	ParameterTypes []TypeExpression
+	ReturnType     TypeExpression // nil when it isn't annotated
+	Body           *BlockStatement
+	Name           string
+	Generator      bool // its body yields, calling it makes a generator
+	Defers         bool // its body has a defer statement
+}
+
+// the annotation of the i-th parameter, nil when there's none
+func (fl *FunctionLiteral) ParameterType(i int) TypeExpression {
+	if i < len(fl.ParameterTypes) {
+		return fl.ParameterTypes[i]
+	}
+	return nil
+}
+
+// whether a parameter or the result is annotated
+func (fl *FunctionLiteral) Annotated() bool {
+	if fl.ReturnType != nil {
+		return true
+	}
+	for _, t := range fl.ParameterTypes {
+		if t != nil {
+			return true
+		}
+	}
+	return false
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
-	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
-	}
 	out.WriteString(fl.TokenLiteral())
 	if fl.Name != "" {
 		out.WriteString(fmt.Sprintf("<%s>", fl.Name))
 	}
-	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") ")
+	out.WriteString(fl.signature())
 	out.WriteString(fl.Body.String())
 	return out.String()
 }
 
+// (x: int, ys) -> bool, with a space after it
+func (fl *FunctionLiteral) signature() string {
+	params := []string{}
+	for i, p := range fl.Parameters {
+		if t := fl.ParameterType(i); t != nil {
+			params = append(params, p.String()+": "+t.String())
+			continue
+		}
+		params = append(params, p.String())
+	}
+	out := "(" + strings.Join(params, ", ") + ") "
+	if fl.ReturnType != nil {
+		out += "-> " + fl.ReturnType.String() + " "
+	}
+	return out
+}
+
+// TypeExpression is a type annotation, the int of x: int
+type TypeExpression interface {
+	Node
+	typeNode()
+}
+
+// NamedType is int, string, bool, null and any,
+// or the name of a struct, class or enum
+type NamedType struct {
+	Token token.Token // the token.IDENT
+	Name  string
+}
+
+func (nt *NamedType) typeNode()            {}
+func (nt *NamedType) TokenLiteral() string { return nt.Token.Literal }
+func (nt *NamedType) String() string       { return nt.Name }
+
+// ArrayType is [int], an array of ints
+type ArrayType struct {
+	Token   token.Token // the '['
+	Element TypeExpression
+}
+
+func (at *ArrayType) typeNode()            {}
+func (at *ArrayType) TokenLiteral() string { return at.Token.Literal }
+func (at *ArrayType) String() string       { return "[" + at.Element.String() + "]" }
+
+// HashType is {string: int}
+type HashType struct {
+	Token token.Token // the '{'
+	Key   TypeExpression
+	Value TypeExpression
+}
+
+func (ht *HashType) typeNode()            {}
+func (ht *HashType) TokenLiteral() string { return ht.Token.Literal }
+func (ht *HashType) String() string {
+	return "{" + ht.Key.String() + ": " + ht.Value.String() + "}"
+}
+
+// FunctionType is fn(int, string) -> bool, Return is nil when it's left out
+type FunctionType struct {
+	Token      token.Token // the 'fn'
+	Parameters []TypeExpression
+	Return     TypeExpression
+}
+
+func (ft *FunctionType) typeNode()            {}
+func (ft *FunctionType) TokenLiteral() string { return ft.Token.Literal }
+func (ft *FunctionType) String() string {
+	params := []string{}
+	for _, p := range ft.Parameters {
+		params = append(params, p.String())
+	}
+	out := "fn(" + strings.Join(params, ", ") + ")"
+	if ft.Return != nil {
+		out += " -> " + ft.Return.String()
+	}
+	return out
+}
+
+// UnionType is int | string, a value of either type
+type UnionType struct {
+	Token token.Token // the first '|'
+	Types []TypeExpression
+}
+
+func (ut *UnionType) typeNode()            {}
+func (ut *UnionType) TokenLiteral() string { return ut.Token.Literal }
+func (ut *UnionType) String() string {
+	types := []string{}
+	for _, t := range ut.Types {
+		types = append(types, t.String())
+	}
+	return strings.Join(types, " | ")
+}
+
 // Function call is an expression
 type CallExpression struct {
-	Token token.Token // The '(' token
+	Token token.Token // The '(' token, or the '|>' token of a pipeline stage
 	// Identifier function call: callsFunction(2, 3, fn(x, y) { x + y; });
 	// FunctionLiteral function call: fn(x, y) { x + y } (1, 2)
 	Function  Expression // Identifier or FunctionLiteral
@@ -316,6 +686,9 @@ type HashLiteral struct {
 	// three types for hash key (checked by evaluation):
 	// 1. string 2. boolean 3. integer
 	Pairs map[Expression]Expression
+	// keys of Pairs and spreads like {...defaults}, in source order,
+	// later entries win over earlier ones
+	Keys []Expression
 }
 
 func (hl *HashLiteral) expressionNode() {}
@@ -325,11 +698,208 @@ func (hl *HashLiteral) TokenLiteral() string {
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Entries() {
+		if spread, ok := key.(*SpreadElement); ok {
+			pairs = append(pairs, spread.String())
+			continue
+		}
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
 	out.WriteString("}")
 	return out.String()
 }
+
+// the keys and spreads in evaluation order,
+// falls back to sorted keys when the literal wasn't built by the parser
+func (hl *HashLiteral) Entries() []Expression {
+	if hl.Keys != nil {
+		return hl.Keys
+	}
+	keys := []Expression{}
+	for k := range hl.Pairs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
+// SetLiteral is an expression, e.g. #{1, 2, ...xs}
+type SetLiteral struct {
+	Token    token.Token // the '#{' token
+	Elements []Expression
+}
+
+func (sl *SetLiteral) expressionNode()      {}
+func (sl *SetLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *SetLiteral) String() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, el := range sl.Elements {
+		elements = append(elements, el.String())
+	}
+	out.WriteString("#{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// member access is an expression
+// e.g. config.server.port, sugar for config["server"]["port"]
+type MemberExpression struct {
+	Token  token.Token // The . token
+	Object Expression
+	Member *Identifier // the field name, always an identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(me.Object.String())
+	out.WriteString(".")
+	out.WriteString(me.Member.String())
+	out.WriteString(")")
+	return out.String()
+}
+
+// slicing is an expression
+// e.g. a[1:3], a[:2], a[1:], Start and End are nil when omitted
+type SliceExpression struct {
+	Token token.Token // The [ token
+	Left  Expression
+	Start Expression
+	End   Expression
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("])")
+	return out.String()
+}
+
+// assignment is an expression, it evaluates to the assigned value
+// e.g. a[0] = 1, config.port = 80
+type AssignExpression struct {
+	Token  token.Token // The = token
+	Target Expression  // IndexExpression or MemberExpression
+	Value  Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" = ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+	return out.String()
+}
+
+// spread is only an expression inside array literals, hash literals and call arguments
+// e.g. [...a, 1], {...defaults}, f(...args)
+type SpreadElement struct {
+	Token token.Token // The ... token
+	Value Expression
+}
+
+func (se *SpreadElement) expressionNode()      {}
+func (se *SpreadElement) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadElement) String() string       { return "..." + se.Value.String() }
+
+// a named argument of a call, after the positional ones
+// e.g. connect(h, port: 80, tls: true)
+type KeywordArgument struct {
+	Token token.Token // The name's token
+	Name  *Identifier
+	Value Expression
+}
+
+func (ka *KeywordArgument) expressionNode()      {}
+func (ka *KeywordArgument) TokenLiteral() string { return ka.Token.Literal }
+func (ka *KeywordArgument) String() string       { return ka.Name.String() + ": " + ka.Value.String() }
+
+// the "for x in xs if cond" part shared by comprehensions
+type ComprehensionClause struct {
+	Variables []*Identifier // for x in xs, or for k, v in h
+	Iterable  Expression
+	Condition Expression // optional filter
+}
+
+func (cc *ComprehensionClause) String() string {
+	var out bytes.Buffer
+	vars := []string{}
+	for _, v := range cc.Variables {
+		vars = append(vars, v.String())
+	}
+	out.WriteString(" for ")
+	out.WriteString(strings.Join(vars, ", "))
+	out.WriteString(" in ")
+	out.WriteString(cc.Iterable.String())
+	if cc.Condition != nil {
+		out.WriteString(" if ")
+		out.WriteString(cc.Condition.String())
+	}
+	return out.String()
+}
+
+// array comprehension is an expression
+// e.g. [x * 2 for x in xs if x > 0]
+type ArrayComprehension struct {
+	Token   token.Token // the '[' token
+	Element Expression
+	ComprehensionClause
+}
+
+func (ac *ArrayComprehension) expressionNode()      {}
+func (ac *ArrayComprehension) TokenLiteral() string { return ac.Token.Literal }
+func (ac *ArrayComprehension) String() string {
+	return "[" + ac.Element.String() + ac.ComprehensionClause.String() + "]"
+}
+
+// hash comprehension is an expression
+// e.g. {k: v * 2 for k, v in h}
+type HashComprehension struct {
+	Token token.Token // the '{' token
+	Key   Expression
+	Value Expression
+	ComprehensionClause
+}
+
+func (hc *HashComprehension) expressionNode()      {}
+func (hc *HashComprehension) TokenLiteral() string { return hc.Token.Literal }
+func (hc *HashComprehension) String() string {
+	return "{" + hc.Key.String() + ":" + hc.Value.String() + hc.ComprehensionClause.String() + "}"
+}
+
+// set comprehension is an expression
+// e.g. #{x * 2 for x in xs}
+type SetComprehension struct {
+	Token   token.Token // the '#{' token
+	Element Expression
+	ComprehensionClause
+}
+
+func (sc *SetComprehension) expressionNode()      {}
+func (sc *SetComprehension) TokenLiteral() string { return sc.Token.Literal }
+func (sc *SetComprehension) String() string {
+	return "#{" + sc.Element.String() + sc.ComprehensionClause.String() + "}"
+}
@@ -0,0 +1,803 @@
+package checker
+
+import (
+	"fmt"
+
+	"sawyer.com/v9/src/monkey/ast"
+	"sawyer.com/v9/src/monkey/token"
+)
+
+// Checker infers the types of a program and checks them before it's compiled.
+// annotations are optional, unannotated code stays dynamic: a value of type
+// any is never an error. what's checked everywhere is what goes into an
+// annotation, an annotated let, argument or return. the operations, calls and
+// indexes are checked only in the bodies of functions that are annotated
+type Checker struct {
+	scope *scope
+	// the structs, classes and enums declared so far
+	names map[string]*Named
+	// the methods of every class, by class name
+	methods map[string]map[string]*Function
+	// the function whose body is being checked, nil at the top level
+	fn     *function
+	errors []string
+}
+
+type function struct {
+	// the annotated result, nil when it's inferred from the returns
+	returns  Type
+	returned []Type
+	// its operations are checked
+	strict    bool
+	generator bool
+}
+
+type binding struct {
+	t        Type
+	declared bool // its type comes from an annotation
+}
+
+type scope struct {
+	store map[string]binding
+	outer *scope
+}
+
+func (s *scope) get(name string) (binding, bool) {
+	b, ok := s.store[name]
+	if !ok && s.outer != nil {
+		return s.outer.get(name)
+	}
+	return b, ok
+}
+
+func New() *Checker {
+	return &Checker{
+		scope:   &scope{store: make(map[string]binding)},
+		names:   make(map[string]*Named),
+		methods: make(map[string]map[string]*Function),
+	}
+}
+
+// Check returns the diagnostics of program. the top-level names it defines
+// are kept for the next program checked, the repl's next line,
+// unless there are diagnostics, then they're forgotten
+func (c *Checker) Check(program *ast.Program) []string {
+	c.errors = []string{}
+	saved := make(map[string]binding, len(c.scope.store))
+	for name, b := range c.scope.store {
+		saved[name] = b
+	}
+	// a type can be used before it's declared
+	for _, s := range program.Statements {
+		c.declare(s)
+	}
+	for _, s := range program.Statements {
+		c.statement(s)
+	}
+	if len(c.errors) != 0 {
+		c.scope.store = saved
+	}
+	return c.errors
+}
+
+func (c *Checker) errorf(tok token.Token, format string, a ...interface{}) {
+	c.errors = append(c.errors, fmt.Sprintf("%d:%d: %s", tok.Line, tok.Column, fmt.Sprintf(format, a...)))
+}
+
+func (c *Checker) strict() bool {
+	return c.fn != nil && c.fn.strict
+}
+
+func (c *Checker) enterScope() {
+	c.scope = &scope{store: make(map[string]binding), outer: c.scope}
+}
+
+func (c *Checker) leaveScope() {
+	c.scope = c.scope.outer
+}
+
+func (c *Checker) define(name string, t Type, declared bool) {
+	c.scope.store[name] = binding{t: t, declared: declared}
+}
+
+func (c *Checker) declare(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.StructStatement:
+		c.names[s.Name.Value] = &Named{Name: s.Name.Value}
+	case *ast.EnumStatement:
+		c.names[s.Name.Value] = &Named{Name: s.Name.Value}
+	case *ast.ClassStatement:
+		if _, ok := c.names[s.Name.Value]; !ok {
+			c.names[s.Name.Value] = &Named{Name: s.Name.Value}
+		}
+	}
+}
+
+// the type an annotation stands for
+func (c *Checker) resolve(t ast.TypeExpression) Type {
+	switch t := t.(type) {
+	case *ast.NamedType:
+		switch t.Name {
+		case "int":
+			return Int
+		case "string":
+			return String
+		case "bool":
+			return Bool
+		case "null":
+			return Null
+		case "range":
+			return Range
+		case "set":
+			return Set
+		case "any":
+			return Any
+		}
+		if named, ok := c.names[t.Name]; ok {
+			return named
+		}
+		c.errorf(t.Token, "unknown type %s", t.Name)
+		return Any
+	case *ast.ArrayType:
+		return &Array{Element: c.resolve(t.Element)}
+	case *ast.HashType:
+		return &Hash{Key: c.resolve(t.Key), Value: c.resolve(t.Value)}
+	case *ast.FunctionType:
+		fn := &Function{Return: Any}
+		for _, p := range t.Parameters {
+			fn.Parameters = append(fn.Parameters, c.resolve(p))
+		}
+		if t.Return != nil {
+			fn.Return = c.resolve(t.Return)
+		}
+		return fn
+	case *ast.UnionType:
+		types := []Type{}
+		for _, m := range t.Types {
+			types = append(types, c.resolve(m))
+		}
+		return union(types...)
+	}
+	return Any
+}
+
+// the type of the statement's value, never for a return or a throw
+func (c *Checker) statement(s ast.Statement) Type {
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		return c.expression(s.Expression)
+	case *ast.LetStatement:
+		c.let(s)
+	case *ast.ReturnStatement:
+		t := c.expression(s.ReturnValue)
+		if c.fn == nil || c.fn.generator {
+			return Never
+		}
+		if c.fn.returns == nil {
+			c.fn.returned = append(c.fn.returned, t)
+		} else if !assignable(c.fn.returns, t) {
+			c.errorf(s.Token, "cannot use %s as %s in return", t, c.fn.returns)
+		}
+		return Never
+	case *ast.ThrowStatement:
+		c.expression(s.Value)
+		return Never
+	case *ast.DeferStatement:
+		c.expression(s.Call)
+	case *ast.ForStatement:
+		c.enterScope()
+		c.clause(&s.ComprehensionClause)
+		c.block(s.Body)
+		c.leaveScope()
+	case *ast.BlockStatement:
+		return c.block(s)
+	case *ast.StructStatement:
+		named := c.names[s.Name.Value]
+		ctor := &Function{Return: named, Names: []string{}}
+		for _, f := range s.Fields {
+			ctor.Parameters = append(ctor.Parameters, Any)
+			ctor.Names = append(ctor.Names, f.Value)
+		}
+		c.define(s.Name.Value, ctor, false)
+	case *ast.EnumStatement:
+		c.define(s.Name.Value, Any, false)
+	case *ast.ClassStatement:
+		c.class(s)
+	case *ast.ImportStatement:
+		c.define(s.Name.Value, Any, false)
+	}
+	return Null
+}
+
+func (c *Checker) let(s *ast.LetStatement) {
+	var declared Type
+	if s.Type != nil {
+		declared = c.resolve(s.Type)
+	}
+	var t Type
+	if fl, ok := s.Value.(*ast.FunctionLiteral); ok {
+		// bound before the body is checked, it may call itself
+		expected, _ := declared.(*Function)
+		sig := c.signature(fl, expected)
+		if declared != nil {
+			c.define(s.Name.Value, declared, true)
+		} else {
+			c.define(s.Name.Value, sig, false)
+		}
+		c.functionBody(fl, sig, nil)
+		t = sig
+	} else {
+		t = c.expression(s.Value)
+	}
+	if declared != nil {
+		if !assignable(declared, t) {
+			c.errorf(s.Name.Token, "cannot use %s as %s in let %s", t, declared, s.Name.Value)
+		}
+		c.define(s.Name.Value, declared, true)
+		return
+	}
+	c.define(s.Name.Value, t, false)
+}
+
+// the statements of a block in a scope of their own, and the block's value
+func (c *Checker) block(block *ast.BlockStatement) Type {
+	c.enterScope()
+	defer c.leaveScope()
+	return c.statements(block.Statements)
+}
+
+func (c *Checker) statements(statements []ast.Statement) Type {
+	var value Type = Null
+	for _, s := range statements {
+		t := c.statement(s)
+		if value != Never {
+			value = t
+		}
+	}
+	return value
+}
+
+// the type of a function literal from its annotations. an unannotated
+// parameter is any, unless the literal goes where a function is expected
+func (c *Checker) signature(fl *ast.FunctionLiteral, expected *Function) *Function {
+	sig := &Function{Return: Any, Names: []string{}}
+	for i := range fl.Parameters {
+		var t Type = Any
+		if ann := fl.ParameterType(i); ann != nil {
+			t = c.resolve(ann)
+		} else if expected != nil && !expected.Variadic && len(expected.Parameters) == len(fl.Parameters) {
+			t = expected.Parameters[i]
+		}
+		sig.Parameters = append(sig.Parameters, t)
+		sig.Names = append(sig.Names, fl.Parameters[i].Value)
+	}
+	if fl.ReturnType != nil && !fl.Generator {
+		sig.Return = c.resolve(fl.ReturnType)
+	}
+	return sig
+}
+
+// check the body of fl, its result is inferred into sig unless it's annotated.
+// self is bound for a method
+func (c *Checker) functionBody(fl *ast.FunctionLiteral, sig *Function, self Type) {
+	outer := c.fn
+	c.fn = &function{strict: fl.Annotated(), generator: fl.Generator}
+	defer func() { c.fn = outer }()
+	if fl.ReturnType != nil && !fl.Generator {
+		c.fn.returns = sig.Return
+	}
+
+	c.enterScope()
+	defer c.leaveScope()
+	if self != nil {
+		c.define("self", self, true)
+	}
+	for i, p := range fl.Parameters {
+		c.define(p.Value, sig.Parameters[i], fl.ParameterType(i) != nil)
+	}
+	value := c.statements(fl.Body.Statements)
+
+	switch {
+	case fl.Generator:
+		// calling it makes a generator
+	case c.fn.returns != nil:
+		if !assignable(c.fn.returns, value) {
+			c.errorf(fl.Token, "cannot use %s as %s in return", value, c.fn.returns)
+		}
+	default:
+		sig.Return = union(append(c.fn.returned, value)...)
+	}
+}
+
+func (c *Checker) class(s *ast.ClassStatement) {
+	named := c.names[s.Name.Value]
+	methods := make(map[string]*Function)
+	c.methods[s.Name.Value] = methods
+	if s.Super != nil {
+		if super, ok := c.names[s.Super.Value]; ok {
+			named.Super = super
+			for name, m := range c.methods[super.Name] {
+				methods[name] = m
+			}
+		}
+	}
+	// the signatures first, a method may call one declared after it
+	sigs := make([]*Function, len(s.Methods))
+	for i, m := range s.Methods {
+		sigs[i] = c.signature(m.Function, nil)
+		methods[m.Name.Value] = sigs[i]
+	}
+	ctor := &Function{Return: named}
+	if init, ok := methods["init"]; ok {
+		ctor.Parameters = init.Parameters
+		ctor.Names = init.Names
+	}
+	c.define(s.Name.Value, ctor, false)
+	for i, m := range s.Methods {
+		c.functionBody(m.Function, sigs[i], named)
+	}
+}
+
+func (c *Checker) expression(e ast.Expression) Type {
+	switch e := e.(type) {
+	case nil:
+		return Null
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.StringLiteral:
+		return String
+	case *ast.Boolean:
+		return Bool
+	case *ast.Identifier:
+		if b, ok := c.scope.get(e.Value); ok {
+			return b.t
+		}
+		// a builtin, or undefined, which the compiler reports
+		return Any
+	case *ast.PrefixExpression:
+		right := c.expression(e.Right)
+		if e.Operator == "!" {
+			return Bool
+		}
+		if c.strict() && !assignable(Int, right) || !mayBe(right, Int) {
+			c.errorf(e.Token, "invalid operation: %s%s", e.Operator, right)
+		}
+		return Int
+	case *ast.InfixExpression:
+		return c.infix(e)
+	case *ast.IfExpression:
+		c.expression(e.Condition)
+		consequence := c.block(e.Consequence)
+		if e.Alternative == nil {
+			return union(consequence, Null)
+		}
+		return union(consequence, c.block(e.Alternative))
+	case *ast.TryExpression:
+		t := c.block(e.Block)
+		if e.Catch != nil {
+			c.enterScope()
+			if e.Param != nil {
+				c.define(e.Param.Value, Any, false)
+			}
+			t = union(t, c.statements(e.Catch.Statements))
+			c.leaveScope()
+		}
+		if e.Finally != nil {
+			c.block(e.Finally)
+		}
+		return t
+	case *ast.FunctionLiteral:
+		sig := c.signature(e, nil)
+		c.functionBody(e, sig, nil)
+		return sig
+	case *ast.CallExpression:
+		return c.call(e)
+	case *ast.ArrayLiteral:
+		elements := []Type{}
+		for _, el := range e.Elements {
+			elements = append(elements, c.element(el))
+		}
+		if len(elements) == 0 {
+			return &Array{Element: Any}
+		}
+		return &Array{Element: union(elements...)}
+	case *ast.HashLiteral:
+		if len(e.Entries()) == 0 {
+			return &Hash{Key: Any, Value: Any}
+		}
+		keys, values := []Type{}, []Type{}
+		for _, k := range e.Entries() {
+			if spread, ok := k.(*ast.SpreadElement); ok {
+				h, ok := c.expression(spread.Value).(*Hash)
+				if !ok {
+					return &Hash{Key: Any, Value: Any}
+				}
+				keys, values = append(keys, h.Key), append(values, h.Value)
+				continue
+			}
+			keys = append(keys, c.expression(k))
+			values = append(values, c.expression(e.Pairs[k]))
+		}
+		return &Hash{Key: union(keys...), Value: union(values...)}
+	case *ast.IndexExpression:
+		return c.index(e)
+	case *ast.SliceExpression:
+		left := c.expression(e.Left)
+		c.expression(e.Start)
+		c.expression(e.End)
+		switch left.(type) {
+		case *Array:
+			return left
+		}
+		if left == String {
+			return String
+		}
+		return Any
+	case *ast.MemberExpression:
+		return c.member(c.expression(e.Object), e.Member.Value)
+	case *ast.AssignExpression:
+		return c.assign(e)
+	case *ast.SpreadElement:
+		return c.expression(e.Value)
+	case *ast.KeywordArgument:
+		return c.expression(e.Value)
+	case *ast.ArrayComprehension:
+		c.enterScope()
+		defer c.leaveScope()
+		c.clause(&e.ComprehensionClause)
+		return &Array{Element: c.expression(e.Element)}
+	case *ast.HashComprehension:
+		c.enterScope()
+		defer c.leaveScope()
+		c.clause(&e.ComprehensionClause)
+		return &Hash{Key: c.expression(e.Key), Value: c.expression(e.Value)}
+	case *ast.RangeExpression:
+		for _, bound := range []ast.Expression{e.Start, e.End, e.Step} {
+			if bound == nil {
+				continue
+			}
+			if t := c.expression(bound); !assignable(Int, t) && c.strict() {
+				c.errorf(e.Token, "cannot use %s as int in range", t)
+			}
+		}
+		return Range
+	case *ast.SetLiteral:
+		for _, el := range e.Elements {
+			c.expression(el)
+		}
+		return Set
+	case *ast.SetComprehension:
+		c.enterScope()
+		defer c.leaveScope()
+		c.clause(&e.ComprehensionClause)
+		c.expression(e.Element)
+		return Set
+	case *ast.YieldExpression:
+		c.expression(e.Value)
+		return Any
+	}
+	return Any
+}
+
+// the type of an array literal's element, ...xs adds the elements of xs
+func (c *Checker) element(e ast.Expression) Type {
+	spread, ok := e.(*ast.SpreadElement)
+	if !ok {
+		return c.expression(e)
+	}
+	if a, ok := c.expression(spread.Value).(*Array); ok {
+		return a.Element
+	}
+	return Any
+}
+
+// bind the variables of for x in xs, or for k, v in h
+func (c *Checker) clause(cc *ast.ComprehensionClause) {
+	iterable := c.expression(cc.Iterable)
+	vars := []Type{}
+	switch it := iterable.(type) {
+	case *Array:
+		vars = []Type{it.Element}
+		if len(cc.Variables) == 2 {
+			vars = []Type{Int, it.Element}
+		}
+	case *Hash:
+		vars = []Type{it.Key, it.Value}
+	}
+	if iterable == String {
+		vars = []Type{String}
+	}
+	if iterable == Range {
+		vars = []Type{Int, Int}
+	}
+	for i, v := range cc.Variables {
+		var t Type = Any
+		if i < len(vars) {
+			t = vars[i]
+		}
+		c.define(v.Value, t, false)
+	}
+	c.expression(cc.Condition)
+}
+
+func (c *Checker) infix(e *ast.InfixExpression) Type {
+	left := c.expression(e.Left)
+	right := c.expression(e.Right)
+	switch e.Operator {
+	case "==", "!=", "in":
+		return Bool
+	case "+":
+		// ints add up, strings concatenate
+		for _, t := range operands["+"] {
+			if assignable(t, left) && assignable(t, right) {
+				if left == Any && right == Any {
+					return Any
+				}
+				return t
+			}
+		}
+	case "-", "*", "/", "<", ">":
+		if assignable(Int, left) && assignable(Int, right) {
+			if e.Operator == "<" || e.Operator == ">" {
+				return Bool
+			}
+			return Int
+		}
+	default:
+		return Any
+	}
+	// outside a strict body an operand of type any may be anything, and an
+	// operation is only wrong for sure when no member of either operand's
+	// union can do it, int | string + int may be fine
+	if c.strict() || left != Any && right != Any && !mayApply(e.Operator, left, right) {
+		c.errorf(e.Token, "invalid operation: %s %s %s", left, e.Operator, right)
+	}
+	return Any
+}
+
+// the types of the operands the arithmetic operators take, both the same
+var operands = map[string][]*Basic{
+	"+": {Int, String},
+	"-": {Int},
+	"*": {Int},
+	"/": {Int},
+	"<": {Int},
+	">": {Int},
+}
+
+func mayApply(operator string, left, right Type) bool {
+	for _, t := range operands[operator] {
+		if mayBe(left, t) && mayBe(right, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Checker) call(e *ast.CallExpression) Type {
+	callee := c.expression(e.Function)
+	args := []Type{}
+	spread := false
+	for _, a := range e.Arguments {
+		if _, ok := a.(*ast.SpreadElement); ok {
+			spread = true
+		}
+		args = append(args, c.expression(a))
+	}
+	fn, ok := callee.(*Function)
+	if !ok {
+		if callee != Any && c.strict() {
+			c.errorf(e.Token, "cannot call %s", callee)
+		}
+		return Any
+	}
+	if spread || fn.Variadic {
+		return fn.Return
+	}
+	if keywords := keywordNames(e.Arguments); keywords != nil {
+		args = c.bindKeywords(e, fn, args, keywords)
+		if args == nil {
+			return fn.Return
+		}
+	}
+	if len(args) != len(fn.Parameters) {
+		// a dynamic call may be meant to fail
+		if c.strict() || annotated(fn) {
+			c.errorf(e.Token, "wrong number of arguments to %s: want=%d, got=%d",
+				e.Function, len(fn.Parameters), len(args))
+		}
+		return fn.Return
+	}
+	for i, arg := range args {
+		if !assignable(fn.Parameters[i], arg) {
+			c.errorf(e.Token, "cannot use %s as %s in argument %d of %s",
+				arg, fn.Parameters[i], i+1, e.Function)
+		}
+	}
+	return fn.Return
+}
+
+// the names of a call's keyword arguments, nil when it has none
+func keywordNames(args []ast.Expression) []string {
+	var names []string
+	for _, a := range args {
+		if kw, ok := a.(*ast.KeywordArgument); ok {
+			names = append(names, kw.Name.Value)
+		}
+	}
+	return names
+}
+
+// args in the order of fn's parameters, nil when they can't be ordered.
+// the last of args are the values of keywords
+func (c *Checker) bindKeywords(e *ast.CallExpression, fn *Function, args []Type, keywords []string) []Type {
+	if fn.Names == nil {
+		return nil
+	}
+	report := c.strict() || annotated(fn)
+	positional := len(args) - len(keywords)
+	indices := make([]int, len(keywords))
+	// the names first, like at runtime
+	for i, name := range keywords {
+		j := indexOf(fn.Names, name)
+		switch {
+		case j < 0:
+			if report {
+				c.errorf(e.Token, "unexpected keyword argument %s to %s", name, e.Function)
+			}
+			return nil
+		case j < positional || indexOf(keywords[:i], name) >= 0:
+			if report {
+				c.errorf(e.Token, "duplicate argument %s to %s", name, e.Function)
+			}
+			return nil
+		}
+		indices[i] = j
+	}
+	// too many for the parameters, the arity check reports it
+	if len(args) > len(fn.Names) {
+		return args
+	}
+	bound := make([]Type, len(fn.Names))
+	copy(bound, args[:positional])
+	for i, j := range indices {
+		bound[j] = args[positional+i]
+	}
+	for i, t := range bound {
+		if t == nil {
+			if report {
+				c.errorf(e.Token, "missing argument %s to %s", fn.Names[i], e.Function)
+			}
+			return nil
+		}
+	}
+	return bound
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// whether a parameter of fn has a type
+func annotated(fn *Function) bool {
+	for _, p := range fn.Parameters {
+		if p != Any {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Checker) index(e *ast.IndexExpression) Type {
+	left := c.expression(e.Left)
+	index := c.expression(e.Index)
+	// xs[1..3] slices xs
+	if index == Range {
+		switch left.(type) {
+		case *Array:
+			return left
+		}
+		if left == String {
+			return String
+		}
+		if left != Any && c.strict() {
+			c.errorf(e.Token, "cannot slice %s", left)
+		}
+		return Any
+	}
+	if left == Range {
+		if c.strict() && !assignable(Int, index) {
+			c.errorf(e.Token, "cannot index %s with %s", left, index)
+		}
+		return Int
+	}
+	switch l := left.(type) {
+	case *Array:
+		if c.strict() && !assignable(Int, index) {
+			c.errorf(e.Token, "cannot index %s with %s", left, index)
+		}
+		return l.Element
+	case *Hash:
+		if c.strict() && !assignable(l.Key, index) {
+			c.errorf(e.Token, "cannot index %s with %s", left, index)
+		}
+		return l.Value
+	}
+	if left == String {
+		if c.strict() && !assignable(Int, index) {
+			c.errorf(e.Token, "cannot index %s with %s", left, index)
+		}
+		return String
+	}
+	if left != Any && c.strict() {
+		c.errorf(e.Token, "cannot index %s", left)
+	}
+	return Any
+}
+
+// obj.name, a hash's value or a class's method
+func (c *Checker) member(object Type, name string) Type {
+	switch o := object.(type) {
+	case *Hash:
+		if assignable(o.Key, String) {
+			return o.Value
+		}
+	case *Named:
+		if m, ok := c.methods[o.Name][name]; ok {
+			return m
+		}
+	}
+	return Any
+}
+
+// xs[i] = v and obj.name = v. what's assigned is checked against the
+// element type when the array or hash is annotated, or in a strict body
+func (c *Checker) assign(e *ast.AssignExpression) Type {
+	value := c.expression(e.Value)
+	var container Type
+	var root ast.Expression
+	switch target := e.Target.(type) {
+	case *ast.IndexExpression:
+		container = c.expression(target.Left)
+		c.expression(target.Index)
+		root = target.Left
+	case *ast.MemberExpression:
+		container = c.expression(target.Object)
+		root = target.Object
+	default:
+		return value
+	}
+	var element Type = Any
+	switch t := container.(type) {
+	case *Array:
+		element = t.Element
+	case *Hash:
+		element = t.Value
+	}
+	if (c.strict() || c.declared(root)) && !assignable(element, value) {
+		c.errorf(e.Token, "cannot use %s as %s in assignment", value, element)
+	}
+	return value
+}
+
+// whether the value of e comes from an annotated binding, xs in xs[0][1]
+func (c *Checker) declared(e ast.Expression) bool {
+	for {
+		switch node := e.(type) {
+		case *ast.Identifier:
+			b, ok := c.scope.get(node.Value)
+			return ok && b.declared
+		case *ast.IndexExpression:
+			e = node.Left
+		case *ast.MemberExpression:
+			e = node.Object
+		default:
+			return false
+		}
+	}
+}
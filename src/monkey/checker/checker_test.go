@@ -0,0 +1,162 @@
+package checker
+
+import (
+	"testing"
+
+	"sawyer.com/v9/src/monkey/ast"
+	"sawyer.com/v9/src/monkey/lexer"
+	"sawyer.com/v9/src/monkey/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let n: int = "a";`, []string{"1:5: cannot use string as int in let n"}},
+		{`let x: Foo = 1`, []string{"1:8: unknown type Foo"}},
+		{`let f = fn(x: string) { x - 1 }`, []string{"1:27: invalid operation: string - int"}},
+		{`let f = fn(x: int | string) -> int { x * 2 }`, []string{"1:40: invalid operation: int | string * int"}},
+		{`let add = fn(a: int, b: int) -> int { a + b }; add(1, "2"); add(1)`, []string{
+			"1:51: cannot use string as int in argument 2 of add",
+			"1:64: wrong number of arguments to add: want=2, got=1",
+		}},
+		{`let f = fn(xs: [string]) -> bool { len(xs) > 0 }; f([1, 2])`,
+			[]string{"1:52: cannot use [int] as [string] in argument 1 of f"}},
+		{`let f = fn(x: int) -> string { if (x > 0) { return 1 }; "a" }`,
+			[]string{"1:45: cannot use int as string in return"}},
+		{`let f = fn() -> int { "a" }`, []string{"1:9: cannot use string as int in return"}},
+		{`let h: {string: int} = {"a": 1, "b": "c"}`,
+			[]string{"1:5: cannot use {string: int | string} as {string: int} in let h"}},
+		{`let xs: [int] = [1]; xs[0] = "a"`, []string{"1:28: cannot use string as int in assignment"}},
+		{`let g: fn(int) -> int = fn(x) { x + 1 }; let k: fn(string) -> int = g`,
+			[]string{"1:46: cannot use fn(int) -> int as fn(string) -> int in let k"}},
+		{`class Animal { name() { "a" } } class Dog extends Animal { } let a: Animal = Dog(); let d: Dog = Animal()`,
+			[]string{"1:89: cannot use Animal as Dog in let d"}},
+		// a type can be used before its declaration
+		{`let p: Point = 1; struct Point { x }`, []string{"1:5: cannot use int as Point in let p"}},
+		{`let f = fn(n: int) -> int { if (n == 0) { 1 } else { n * f(n - 1) } }; let s: string = f(3)`,
+			[]string{"1:76: cannot use int as string in let s"}},
+		// results are inferred
+		{`let g = fn() { "a" }; let n: int = g()`, []string{"1:27: cannot use string as int in let n"}},
+		{`let xs = [1, "a"]; let ys: [int] = xs`, []string{"1:24: cannot use [int | string] as [int] in let ys"}},
+		{`let f = fn(xs: [int]) -> [int] { [x * 2 for x in xs] }; f(["a"])`,
+			[]string{"1:58: cannot use [string] as [int] in argument 1 of f"}},
+		{`class A { init(n: int) { self.n = n } } A("a")`, []string{"1:42: cannot use string as int in argument 1 of A"}},
+		{`let f = fn(s: string) -> int { s() }`, []string{"1:33: cannot call string"}},
+		{`let f = fn(xs: [int]) { xs["a"] }`, []string{"1:27: cannot index [int] with string"}},
+		{`let f = fn(host: string, port: int) { port }; f(port: "80", host: "h"); f("h", tls: true); f(port: 1)`, []string{
+			"1:48: cannot use string as int in argument 2 of f",
+			"1:74: unexpected keyword argument tls to f",
+			"1:93: missing argument host to f",
+		}},
+		{`let f = fn(a: int, b: int) { a }; f(1, b: 2, b: 3); f(a: 1, b: 2, c: 3)`, []string{
+			"1:36: duplicate argument b to f",
+			"1:54: unexpected keyword argument c to f",
+		}},
+		{`let f = fn(s: string) { 0..s }`, []string{"1:26: cannot use string as int in range"}},
+		{`let r: range = 0..3; let n: string = r[0]; let s: string = [1, 2][r]`, []string{
+			"1:26: cannot use int as string in let n",
+			"1:48: cannot use [int] as string in let s",
+		}},
+		{`let f = fn(n: int) -> [int] { [x for x in 0..n] }; let xs: [int] = [1, 2, 3][1..=2]`, []string{}},
+		{`let s: string = #{1}; let t: set = [1]`, []string{
+			"1:5: cannot use set as string in let s",
+			"1:27: cannot use [int] as set in let t",
+		}},
+		{`let f = fn(x: int) -> int { #{1} }; let g = fn(xs: [int]) -> int { #{x for x in xs} }`, []string{
+			"1:9: cannot use set as int in return",
+			"1:45: cannot use set as int in return",
+		}},
+		{`let f = fn(s: set) { s + 1 }`, []string{"1:24: invalid operation: set + int"}},
+		{`let s: set = #{1, 2}; let t: set = #{x for x in s}; let b: bool = 1 in s; let c: bool = s == t`, []string{}},
+		{`let f = fn(xs: [int]) -> string { for (x in xs) { let s: string = x; return x }; "" }`, []string{
+			"1:55: cannot use int as string in let s",
+			"1:70: cannot use int as string in return",
+		}},
+		// arrow functions are annotated like function literals
+		{`let f = (x: int) => x - "a"`, []string{"1:23: invalid operation: int - string"}},
+		{`let add = (x: int, y: int) -> int => x + y; add(1, "2")`,
+			[]string{"1:48: cannot use string as int in argument 2 of add"}},
+		{`let f = (x: int) -> string => x`, []string{"1:9: cannot use int as string in return"}},
+		// operators are checked wherever both types are known
+		{`"a" - 1`, []string{"1:5: invalid operation: string - int"}},
+		{`let n: int = 1; let s: string = "a"; n - s`, []string{"1:40: invalid operation: int - string"}},
+		{`let f = fn() { 1 + true }; f()`, []string{"1:18: invalid operation: int + bool"}},
+		{`let xs = [1]; -xs`, []string{"1:15: invalid operation: -[int]"}},
+		{`let xs = [1, "a"]; -xs[0]; xs[0] - true`, []string{"1:34: invalid operation: int | string - bool"}},
+		{`let f = fn(x: int | string) { -x }`, []string{"1:31: invalid operation: -int | string"}},
+
+		// unannotated code stays dynamic
+		{`let h = {"name": "bob", "age": 30}; h["age"] + 1`, []string{}},
+		{`let a = [1, "a"]; a[0] + 1; a[1] * 2; a[0] + "b"; a[0] < 3`, []string{}},
+		{`let f = fn(x) { x - 1 }; f("a")`, []string{}},
+		{`let a: any = "a"; a - 1; -a`, []string{}},
+		{`let f = fn(a) { a }; f()`, []string{}},
+		{`let xs = [1]; xs[0] = "a"`, []string{}},
+		{`let f = fn(x) { x }; let n: int = f("a")`, []string{}},
+		{`let f = fn(x: int) { let g = fn(y) { y - "a" }; g(x) }`, []string{}},
+		{`let m: int | null = if (true) { 1 }`, []string{}},
+		{`let xs: [int] = []; let h: {string: [int]} = {"a": xs}`, []string{}},
+		{`let f = fn(g: fn(int) -> int, x: int) -> int { g(x) }; f(fn(x) { x * 2 }, 1)`, []string{}},
+		{`let f = fn(n: int, acc: int) -> int { if (n == 0) { return acc }; f(n - 1, acc + n) }`, []string{}},
+		{`let any: any = "a"; let n: int = any`, []string{}},
+		{`let f = fn() -> int { throw "no" }`, []string{}},
+		{`import "lib.monkey" as lib; let n: int = lib.count`, []string{}},
+	}
+	for _, tt := range tests {
+		errors := New().Check(parse(t, tt.input))
+		if len(errors) != len(tt.expected) {
+			t.Errorf("wrong diagnostics for %q: want=%q, got=%q", tt.input, tt.expected, errors)
+			continue
+		}
+		for i, msg := range tt.expected {
+			if errors[i] != msg {
+				t.Errorf("wrong diagnostic for %q: want=%q, got=%q", tt.input, msg, errors[i])
+			}
+		}
+	}
+}
+
+// the names of a program with diagnostics are forgotten, like the repl's failed lines
+func TestCheckKeepsNames(t *testing.T) {
+	c := New()
+	if errors := c.Check(parse(t, `let n: int = 1`)); len(errors) != 0 {
+		t.Fatalf("unexpected diagnostics: %q", errors)
+	}
+	if errors := c.Check(parse(t, `let s: string = n`)); len(errors) != 1 {
+		t.Fatalf("expected n to be an int, got=%q", errors)
+	}
+	c.Check(parse(t, `let n: string = 1`))
+	if errors := c.Check(parse(t, `let m: int = n`)); len(errors) != 0 {
+		t.Fatalf("expected n to still be an int, got=%q", errors)
+	}
+}
+
+func TestUnion(t *testing.T) {
+	tests := []struct {
+		types    []Type
+		expected string
+	}{
+		{[]Type{Int, Int}, "int"},
+		{[]Type{String, Int, String}, "int | string"},
+		{[]Type{Int, &Union{Types: []Type{Null, String}}}, "int | null | string"},
+		{[]Type{Int, Any}, "any"},
+		{[]Type{Never, Bool}, "bool"},
+		{[]Type{&Array{Element: Int}, &Array{Element: Int}}, "[int]"},
+	}
+	for _, tt := range tests {
+		if got := union(tt.types...).String(); got != tt.expected {
+			t.Errorf("wrong union of %v: want=%q, got=%q", tt.types, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package checker
+
+import (
+	"sort"
+	"strings"
+)
+
+// Type is what the checker knows about a value
+type Type interface {
+	String() string
+}
+
+// Basic is one of the types below, compared by identity
+type Basic struct {
+	Name string
+}
+
+func (b *Basic) String() string { return b.Name }
+
+var (
+	Int    = &Basic{Name: "int"}
+	String = &Basic{Name: "string"}
+	Bool   = &Basic{Name: "bool"}
+	Null   = &Basic{Name: "null"}
+	Range  = &Basic{Name: "range"}
+	Set    = &Basic{Name: "set"}
+	// anything, unannotated code is made of it and it's never an error
+	Any = &Basic{Name: "any"}
+	// no value at all, a block that always returns or throws has it
+	Never = &Basic{Name: "never"}
+)
+
+// Array is [T]
+type Array struct {
+	Element Type
+}
+
+func (a *Array) String() string { return "[" + a.Element.String() + "]" }
+
+// Hash is {K: V}
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+func (h *Hash) String() string { return "{" + h.Key.String() + ": " + h.Value.String() + "}" }
+
+// Function is fn(P1, P2) -> R
+type Function struct {
+	Parameters []Type
+	Return     Type
+	// the parameters' names, for keyword arguments, nil when they're unknown
+	Names []string
+	// the arguments aren't known, like a class's init's
+	Variadic bool
+}
+
+func (f *Function) String() string {
+	if f.Variadic {
+		return "fn(...) -> " + f.Return.String()
+	}
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+	return "fn(" + strings.Join(params, ", ") + ") -> " + f.Return.String()
+}
+
+// Union is T1 | T2, a value of any of them. see union, it makes them
+type Union struct {
+	Types []Type
+}
+
+func (u *Union) String() string {
+	types := []string{}
+	for _, t := range u.Types {
+		types = append(types, t.String())
+	}
+	return strings.Join(types, " | ")
+}
+
+// Named is a struct, class or enum, by the name it's declared with
+type Named struct {
+	Name  string
+	Super *Named // the superclass of a class
+}
+
+func (n *Named) String() string { return n.Name }
+
+// the union of types, flattened, without duplicates and sorted.
+// any absorbs the rest, never disappears
+func union(types ...Type) Type {
+	seen := make(map[string]bool)
+	members := []Type{}
+	var add func(t Type)
+	add = func(t Type) {
+		if u, ok := t.(*Union); ok {
+			for _, m := range u.Types {
+				add(m)
+			}
+			return
+		}
+		if t == Never || seen[t.String()] {
+			return
+		}
+		seen[t.String()] = true
+		members = append(members, t)
+	}
+	for _, t := range types {
+		if t == Any {
+			return Any
+		}
+		add(t)
+	}
+	switch len(members) {
+	case 0:
+		return Never
+	case 1:
+		return members[0]
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].String() < members[j].String()
+	})
+	return &Union{Types: members}
+}
+
+// whether a value of type t may be a b at runtime, when some member of a
+// union is one. weaker than assignable, for code that isn't annotated
+func mayBe(t Type, b *Basic) bool {
+	if t == Any || t == Never || t == b {
+		return true
+	}
+	if u, ok := t.(*Union); ok {
+		for _, m := range u.Types {
+			if mayBe(m, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// whether a value of type from can be used where to is expected
+func assignable(to, from Type) bool {
+	if to == Any || from == Any || from == Never {
+		return true
+	}
+	if u, ok := from.(*Union); ok {
+		for _, m := range u.Types {
+			if !assignable(to, m) {
+				return false
+			}
+		}
+		return true
+	}
+	switch to := to.(type) {
+	case *Basic:
+		return to == from
+	case *Union:
+		for _, m := range to.Types {
+			if assignable(m, from) {
+				return true
+			}
+		}
+		return false
+	case *Array:
+		from, ok := from.(*Array)
+		return ok && assignable(to.Element, from.Element)
+	case *Hash:
+		from, ok := from.(*Hash)
+		return ok && assignable(to.Key, from.Key) && assignable(to.Value, from.Value)
+	case *Function:
+		from, ok := from.(*Function)
+		if !ok {
+			return false
+		}
+		if to.Variadic || from.Variadic {
+			return assignable(to.Return, from.Return)
+		}
+		if len(to.Parameters) != len(from.Parameters) {
+			return false
+		}
+		// a function taking more will do where less is passed
+		for i := range to.Parameters {
+			if !assignable(from.Parameters[i], to.Parameters[i]) {
+				return false
+			}
+		}
+		return assignable(to.Return, from.Return)
+	case *Named:
+		// a class will do where its superclass is expected
+		for from, ok := from.(*Named); ok && from != nil; from = from.Super {
+			if from.Name == to.Name {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
@@ -51,6 +51,64 @@ const (
 	// when meeting self-reference closure,
 	// instead of emmiting OpGetFree, we emit this:
 	OpCurrentClosure
+	// member access, the field name sits on top of the object
+	OpGetField
+	// a[start:end], omitted bounds are pushed as null
+	OpSlice
+	// a[i] = v, the value sits on top of the index and the collection
+	OpSetIndex
+	// obj.field = v
+	OpSetField
+	// spread the value on top into the array, hash or set beneath it
+	OpExtend
+	// call with the arguments collected in an array, f(...args)
+	OpCallSpread
+	// replace the iterable on top with an iterator over it
+	OpIter
+	// pop the iterator and push its next 1 or 2 values (2nd operand),
+	// jump to the 1st operand when it's exhausted
+	OpIterNext
+	// append the value on top to the array or set beneath it, pushes nothing
+	OpAppend
+	// load the module whose path is the constant operand, push it
+	OpImport
+	// start a try block, what's thrown inside goes to the operand
+	OpTry
+	// leave the innermost try block
+	OpEndTry
+	// throw the value on top
+	OpThrow
+	OpGetStructField
+	OpSetStructField
+	OpClass
+	OpGetSuper
+	OpYield
+	// a call whose result is returned right away, it reuses the caller's frame
+	OpTailCall
+	// a call with keyword arguments, the second operand is the constant
+	// with their names, their values are the last arguments on the stack
+	OpCallKeywords
+	// queues the callee and the array of its arguments on the frame, the
+	// operand is the constant with the names of the keyword arguments
+	OpDefer
+	// a set of the operand number of elements, like OpArray
+	OpSet
+	// push whether the value beneath the top is in the collection on top
+	OpIn
+	// a range of the start and end beneath the top, the operands are 1
+	// for ..= and 1 when the step is on top
+	OpRange
+	// the class of the method running, for a method naming its own class
+	OpCurrentClass
+	// OpTailCall for a call with keyword arguments, operands like OpCallKeywords
+	OpTailCallKeywords
+	// OpCallSpread for a call with keyword arguments, their values end the
+	// array and the operand is the constant with their names
+	OpCallSpreadKeywords
+	// push an empty box, for a local captured by its own let's value
+	OpBox
+	// fill the box in the operand local with the value on top, left there
+	OpFillBox
 )
 
 // definition for opcode
@@ -92,6 +150,37 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpGetField:       {"OpGetField", []int{}},
+	OpSlice:          {"OpSlice", []int{}},
+	OpSetIndex:       {"OpSetIndex", []int{}},
+	OpSetField:       {"OpSetField", []int{}},
+	OpExtend:         {"OpExtend", []int{}},
+	OpCallSpread:     {"OpCallSpread", []int{}},
+	OpIter:           {"OpIter", []int{}},
+	OpIterNext:       {"OpIterNext", []int{2, 1}},
+	OpAppend:         {"OpAppend", []int{}},
+	OpImport:         {"OpImport", []int{2}},
+	OpTry:            {"OpTry", []int{2}},
+	OpEndTry:         {"OpEndTry", []int{}},
+	OpThrow:          {"OpThrow", []int{}},
+	// the operand is the field's offset, known from the struct's declaration
+	OpGetStructField: {"OpGetStructField", []int{1}},
+	OpSetStructField: {"OpSetStructField", []int{1}},
+	// the operand is the number of methods, pushed as name, closure pairs
+	OpClass:              {"OpClass", []int{1}},
+	OpGetSuper:           {"OpGetSuper", []int{}},
+	OpYield:              {"OpYield", []int{}},
+	OpTailCall:           {"OpTailCall", []int{1}},
+	OpCallKeywords:       {"OpCallKeywords", []int{1, 2}},
+	OpDefer:              {"OpDefer", []int{2}},
+	OpSet:                {"OpSet", []int{2}},
+	OpIn:                 {"OpIn", []int{}},
+	OpRange:              {"OpRange", []int{1, 1}},
+	OpCurrentClass:       {"OpCurrentClass", []int{}},
+	OpTailCallKeywords:   {"OpTailCallKeywords", []int{1, 2}},
+	OpCallSpreadKeywords: {"OpCallSpreadKeywords", []int{2}},
+	OpBox:                {"OpBox", []int{}},
+	OpFillBox:            {"OpFillBox", []int{1}},
 }
 
 // loop up opcode definition
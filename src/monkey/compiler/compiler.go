@@ -2,11 +2,11 @@ package compiler
 
 import (
 	"fmt"
-	"sort"
 
 	"sawyer.com/v9/src/monkey/ast"
 	"sawyer.com/v9/src/monkey/code"
 	"sawyer.com/v9/src/monkey/object"
+	"sawyer.com/v9/src/monkey/token"
 )
 
 type Compiler struct {
@@ -17,6 +17,26 @@ type Compiler struct {
 	scopes []CompilationScope
 	// index of current scope, indicates which code is running currently
 	scopeIndex int
+	// exported names and their global index, when compiling a module
+	exports map[string]int
+	// the globals of a running program compiled against, see RunningGlobals
+	globals []object.Object
+	// the lets whose values are being compiled, innermost last, see resolve
+	lets []pendingLet
+	// how many function literals deep the code being compiled is
+	functionDepth int
+	// the function literal about to be compiled is a top-level for's body
+	loopBody bool
+}
+
+// a let being compiled, its name is already defined in table. before is
+// what the table had under the name, if it had anything
+type pendingLet struct {
+	name   string
+	table  *SymbolTable
+	before Symbol
+	had    bool
+	depth  int
 }
 
 // to keep track of emitted instructions
@@ -25,6 +45,20 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	// pipeline stages by the position of their call, for runtime errors
+	stages map[int]string
+	// what a return has to do to leave the try blocks it's in, innermost last
+	exits []tryExit
+	// compiling a function that yields
+	generator bool
+	// compiling the body of a for loop at the top level, see compileFor
+	loop bool
+}
+
+// a try block being compiled, either its handler that has to be removed
+// or its finally block that has to run
+type tryExit struct {
+	finally *ast.BlockStatement // nil for a handler
 }
 
 func New() *Compiler {
@@ -44,6 +78,7 @@ func New() *Compiler {
 		scopes:      []CompilationScope{mainScope},
 		constants:   []object.Object{},
 		symbolTable: symbolTable,
+		exports:     make(map[string]int),
 	}
 }
 
@@ -54,6 +89,13 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	return compiler
 }
 
+// RunningGlobals has the compiler treat a global as undefined while its
+// slot in globals is unset, for code compiled against a program that's
+// running, like eval's. the symbol table knows the globals defined later too
+func (c *Compiler) RunningGlobals(globals []object.Object) {
+	c.globals = globals
+}
+
 // handle scope and symbol table
 // e.g. enter a function scope
 func (c *Compiler) enterScope() {
@@ -83,6 +125,9 @@ func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		Stages:       c.scopes[c.scopeIndex].stages,
+		Exports:      c.exports,
+		SymbolTable:  c.symbolTable,
 	}
 }
 
@@ -90,6 +135,10 @@ func (c *Compiler) Bytecode() *Bytecode {
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	Stages       map[int]string // pipeline stages of the main program
+	Exports      map[string]int // exported globals of a module
+	// the names of the globals, eval compiles against them
+	SymbolTable *SymbolTable
 }
 
 type EmittedInstruction struct {
@@ -108,24 +157,174 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 	case *ast.LetStatement:
-		// enable recursive function
-		symbol := c.symbolTable.Define(node.Name.Value)
+		if c.symbolTable.IsConst(node.Name.Value) {
+			return fmt.Errorf("cannot reassign const %s", node.Name.Value)
+		}
+		// the name is defined before its value so functions in the value can
+		// refer to the binding, {"f": fn() { h.x }}. the value itself still
+		// reads what the name meant before, `let x = x + 1` in a block reads the outer x
+		before, had := c.symbolTable.store[node.Name.Value]
+		var symbol Symbol
+		if node.Const {
+			symbol = c.symbolTable.DefineConst(node.Name.Value)
+		} else {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
+		// a closure copies the locals it captures when it's made, so it gets a
+		// box the let fills in once it has the value
+		boxed := node.Captured && symbol.Scope == LocalScope
+		if boxed {
+			c.emit(code.OpBox)
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+		c.lets = append(c.lets, pendingLet{name: node.Name.Value, table: c.symbolTable,
+			before: before, had: had, depth: c.functionDepth})
 		err := c.Compile(node.Value)
+		c.lets = c.lets[:len(c.lets)-1]
 		if err != nil {
 			return err
 		}
-		// symbol := c.symbolTable.Define(node.Name.Value)
+		if boxed {
+			c.emit(code.OpFillBox, symbol.Index)
+		}
+		if st := c.constructedStruct(node.Value); st != nil {
+			symbol.Struct = st
+			c.symbolTable.annotate(symbol)
+		}
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+		if node.Export {
+			c.exports[node.Name.Value] = symbol.Index
+		}
+	case *ast.StructStatement:
+		if c.symbolTable.IsConst(node.Name.Value) {
+			return fmt.Errorf("cannot reassign const %s", node.Name.Value)
+		}
+		fields := []string{}
+		for _, f := range node.Fields {
+			fields = append(fields, f.Value)
+		}
+		st := object.NewStructType(node.Name.Value, fields)
+		c.emit(code.OpConstant, c.addConstant(st))
+		symbol := c.symbolTable.Define(node.Name.Value)
+		symbol.Constructs = st
+		c.symbolTable.annotate(symbol)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+	case *ast.EnumStatement:
+		if c.symbolTable.IsConst(node.Name.Value) {
+			return fmt.Errorf("cannot reassign const %s", node.Name.Value)
+		}
+		enum := object.NewEnum(node.Name.Value)
+		for _, v := range node.Variants {
+			fields := []string{}
+			for _, f := range v.Fields {
+				fields = append(fields, f.Value)
+			}
+			enum.AddVariant(v.Name.Value, fields)
+		}
+		c.emit(code.OpConstant, c.addConstant(enum))
+		symbol := c.symbolTable.Define(node.Name.Value)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+	case *ast.ClassStatement:
+		if c.symbolTable.IsConst(node.Name.Value) {
+			return fmt.Errorf("cannot reassign const %s", node.Name.Value)
+		}
+		err := c.compileClass(node)
+		if err != nil {
+			return err
+		}
+		symbol := c.symbolTable.Define(node.Name.Value)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+	case *ast.YieldExpression:
+		// a comprehension is compiled to a function of its own, it can't yield for the enclosing one
+		if !c.scopes[c.scopeIndex].generator {
+			return fmt.Errorf("yield inside a comprehension")
+		}
+		if node.Delegate {
+			return c.compileYieldDelegate(node)
+		}
+		if node.Value != nil {
+			err := c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+		} else {
+			c.emit(code.OpNull)
+		}
+		c.emit(code.OpYield)
+	case *ast.SuperExpression:
+		// the superclass, self and the method's name
+		super, ok := c.symbolTable.Resolve("super")
+		if !ok {
+			return fmt.Errorf("super used outside of a class")
+		}
+		c.loadSymbol(super)
+		self, ok := c.symbolTable.Resolve("self")
+		if !ok {
+			return fmt.Errorf("super used outside of a class")
+		}
+		c.loadSymbol(self)
+		name := &object.String{Value: node.Method.Value}
+		c.emit(code.OpConstant, c.addConstant(name))
+		c.emit(code.OpGetSuper)
+	case *ast.ImportStatement:
+		if c.symbolTable.IsConst(node.Name.Value) {
+			return fmt.Errorf("cannot reassign const %s", node.Name.Value)
+		}
+		// the module is loaded at runtime, by the path it's imported with
+		path := &object.String{Value: node.Path}
+		c.emit(code.OpImport, c.addConstant(path))
+		symbol := c.symbolTable.Define(node.Name.Value)
 		if symbol.Scope == GlobalScope {
 			c.emit(code.OpSetGlobal, symbol.Index)
 		} else {
 			c.emit(code.OpSetLocal, symbol.Index)
 		}
 	case *ast.ReturnStatement:
+		// it would only leave the function the loop's body is compiled to
+		if c.scopes[c.scopeIndex].loop {
+			return fmt.Errorf("return in a for loop outside of a function")
+		}
 		err := c.Compile(node.ReturnValue)
 		if err != nil {
 			return err
 		}
+		err = c.compileExits()
+		if err != nil {
+			return err
+		}
 		c.emit(code.OpReturnValue)
+	case *ast.DeferStatement:
+		err := c.compileDefer(node.Call)
+		if err != nil {
+			return err
+		}
+	case *ast.ForStatement:
+		err := c.compileFor(node)
+		if err != nil {
+			return err
+		}
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
 	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression)
 		if err != nil {
@@ -185,9 +384,32 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpEqual)
 		case "!=":
 			c.emit(code.OpNotEqual)
+		case "in":
+			c.emit(code.OpIn)
 		default:
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
+	case *ast.RangeExpression:
+		err := c.Compile(node.Start)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(node.End)
+		if err != nil {
+			return err
+		}
+		inclusive, step := 0, 0
+		if node.Inclusive {
+			inclusive = 1
+		}
+		if node.Step != nil {
+			err = c.Compile(node.Step)
+			if err != nil {
+				return err
+			}
+			step = 1
+		}
+		c.emit(code.OpRange, inclusive, step)
 	case *ast.IfExpression:
 		err := c.Compile(node.Condition)
 		if err != nil {
@@ -195,14 +417,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		// Emit an `OpJumpNotTruthy` with a bogus value
 		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
-		err = c.Compile(node.Consequence)
+		err = c.compileBlock(node.Consequence)
 		if err != nil {
 			return err
 		}
-		// remove redundant pop emitted by compile expressionStatement
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
-		}
 		// Emit an `OpJump` with a bogus value
 		jumpPos := c.emit(code.OpJump, 9999)
 		afterConsequencePos := len(c.currentInstructions())
@@ -210,16 +428,18 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if node.Alternative == nil {
 			c.emit(code.OpNull)
 		} else {
-			err := c.Compile(node.Alternative)
+			err := c.compileBlock(node.Alternative)
 			if err != nil {
 				return err
 			}
-			if c.lastInstructionIs(code.OpPop) {
-				c.removeLastPop()
-			}
 		}
 		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
+	case *ast.TryExpression:
+		if node.Finally == nil {
+			return c.compileTryCatch(node)
+		}
+		return c.compileTryFinally(node)
 	case *ast.BlockStatement:
 		for _, s := range node.Statements {
 			err := c.Compile(s)
@@ -230,7 +450,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 	case *ast.IntegerLiteral:
 		// save integer to constant pool
 		// emit the opcode instruction
-		integer := &object.Integer{Value: node.Value}
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = &object.BigInt{Value: node.Big}
+		}
 		c.emit(code.OpConstant, c.addConstant(integer))
 	case *ast.StringLiteral:
 		str := &object.String{Value: node.Value}
@@ -242,7 +465,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpFalse)
 		}
 	case *ast.Identifier:
-		symbol, ok := c.symbolTable.Resolve(node.Value)
+		symbol, ok := c.resolve(node.Value)
+		if ok && symbol.Scope == GlobalScope && c.globals != nil && c.globals[symbol.Index] == nil {
+			ok = false
+		}
 		if !ok {
 			// compile time error
 			return fmt.Errorf("undefined variable %s", node.Value)
@@ -250,6 +476,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 		// get Identifier from symbol table
 		c.loadSymbol(symbol)
 	case *ast.ArrayLiteral:
+		if hasSpread(node.Elements) {
+			return c.compileSpreadList(code.OpArray, node.Elements)
+		}
 		for _, el := range node.Elements {
 			err := c.Compile(el)
 			if err != nil {
@@ -258,14 +487,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpArray, len(node.Elements))
 	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-		for k := range node.Pairs {
-			keys = append(keys, k)
+		// keys in source order, so later spreads and keys win
+		keys := node.Entries()
+		if hasSpread(keys) {
+			return c.compileSpreadHash(node, keys)
 		}
-		// for unit test
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
 		for _, k := range keys {
 			err := c.Compile(k)
 			if err != nil {
@@ -277,6 +503,51 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.SetLiteral:
+		if hasSpread(node.Elements) {
+			return c.compileSpreadList(code.OpSet, node.Elements)
+		}
+		for _, el := range node.Elements {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSet, len(node.Elements))
+	case *ast.SetComprehension:
+		return c.compileComprehension(&node.ComprehensionClause, code.OpSet, func() error {
+			err := c.Compile(node.Element)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpAppend)
+			return nil
+		})
+	case *ast.ArrayComprehension:
+		return c.compileComprehension(&node.ComprehensionClause, code.OpArray, func() error {
+			err := c.Compile(node.Element)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpAppend)
+			return nil
+		})
+	case *ast.HashComprehension:
+		return c.compileComprehension(&node.ComprehensionClause, code.OpHash, func() error {
+			err := c.Compile(node.Key)
+			if err != nil {
+				return err
+			}
+			err = c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpSetIndex)
+			c.emit(code.OpPop)
+			return nil
+		})
+	case *ast.SpreadElement:
+		return fmt.Errorf("spread is only allowed in array, hash and set literals and calls")
 	case *ast.IndexExpression:
 		err := c.Compile(node.Left)
 		if err != nil {
@@ -287,9 +558,81 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 		c.emit(code.OpIndex)
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		for _, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			err := c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
+	case *ast.MemberExpression:
+		err := c.Compile(node.Object)
+		if err != nil {
+			return err
+		}
+		if offset, ok := c.structField(node); ok {
+			c.emit(code.OpGetStructField, offset)
+			return nil
+		}
+		// the field name is just a string constant
+		name := &object.String{Value: node.Member.Value}
+		c.emit(code.OpConstant, c.addConstant(name))
+		c.emit(code.OpGetField)
+	case *ast.AssignExpression:
+		// push the collection and the key first, then the value
+		switch target := node.Target.(type) {
+		case *ast.IndexExpression:
+			err := c.Compile(target.Left)
+			if err != nil {
+				return err
+			}
+			err = c.Compile(target.Index)
+			if err != nil {
+				return err
+			}
+			err = c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpSetIndex)
+		case *ast.MemberExpression:
+			err := c.Compile(target.Object)
+			if err != nil {
+				return err
+			}
+			if offset, ok := c.structField(target); ok {
+				err = c.Compile(node.Value)
+				if err != nil {
+					return err
+				}
+				c.emit(code.OpSetStructField, offset)
+				return nil
+			}
+			name := &object.String{Value: target.Member.Value}
+			c.emit(code.OpConstant, c.addConstant(name))
+			err = c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpSetField)
+		default:
+			return fmt.Errorf("invalid assignment target: %s", node.Target)
+		}
 	case *ast.FunctionLiteral:
 		// scope is defined when the function literal is defined
 		c.enterScope()
+		c.functionDepth++
+		c.scopes[c.scopeIndex].generator = node.Generator
+		c.scopes[c.scopeIndex].loop, c.loopBody = c.loopBody, false
 
 		// save function's name
 		if node.Name != "" {
@@ -314,11 +657,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if !c.lastInstructionIs(code.OpReturnValue) {
 			c.emit(code.OpReturn)
 		}
+		markTailCalls(c.currentInstructions(), c.scopes[c.scopeIndex].stages)
 		// noteworthy: save free variables before leaving current scope
 		freeSymbols := c.symbolTable.FreeSymbols
 		// numLocals = len(parameter) + len(locals)
-		numLocals := c.symbolTable.numDefinitions
+		numLocals := c.symbolTable.numLocals()
+		stages := c.scopes[c.scopeIndex].stages
 		instructions := c.leaveScope()
+		c.functionDepth--
 
 		// put free variables as locals on the stack before emitting function literal
 		// when to pop these free variables???
@@ -333,6 +679,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			Parameters:    parameterNames(node.Parameters),
+			Stages:        stages,
+			Generator:     node.Generator,
 		}
 		fnIndex := c.addConstant(compiledFn)
 		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
@@ -343,17 +692,705 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
-		// Equevilent to SetLocal
-		// Make local bindings here
-		for _, a := range node.Arguments {
+		names := keywordNames(node.Arguments)
+		// the number of arguments is only known at runtime
+		if hasSpread(node.Arguments) {
+			// the keywords' values end the array
+			err := c.compileSpreadList(code.OpArray, argumentValues(node.Arguments))
+			if err != nil {
+				return err
+			}
+			if names == nil {
+				c.emit(code.OpCallSpread)
+			} else {
+				c.emit(code.OpCallSpreadKeywords, c.addNames(names))
+			}
+		} else if names != nil {
+			// positional arguments first, then the keywords' values
+			for _, a := range argumentValues(node.Arguments) {
+				err := c.Compile(a)
+				if err != nil {
+					return err
+				}
+			}
+			c.emit(code.OpCallKeywords, len(node.Arguments), c.addNames(names))
+		} else {
+			// Equevilent to SetLocal
+			// Make local bindings here
+			for _, a := range node.Arguments {
+				err := c.Compile(a)
+				if err != nil {
+					return err
+				}
+			}
+
+			c.emit(code.OpCall, len(node.Arguments))
+		}
+		if node.Token.Type == token.PIPE {
+			c.addStage(node)
+		}
+	}
+	return nil
+}
+
+// compile the block of an if/else in its own block scope,
+// so its lets are gone once the block ends.
+// the block leaves its last expression on the stack, or null when
+// it's empty or ends with a let
+func (c *Compiler) compileBlock(block *ast.BlockStatement) error {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	err := c.Compile(block)
+	c.symbolTable = c.symbolTable.Outer
+	if err != nil {
+		return err
+	}
+	// remove redundant pop emitted by compile expressionStatement
+	if endsWithExpression(block) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+func endsWithExpression(block *ast.BlockStatement) bool {
+	if len(block.Statements) == 0 {
+		return false
+	}
+	_, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+// yield* g calls g.next() until it's done, yielding every value on the way.
+// what g returns is left on the stack
+//
+//	g; set $delegate
+//	loop: $delegate.next(); set $step
+//	$step.done; OpJumpNotTruthy more
+//	$step.value; OpJump end
+//	more: $step.value; OpYield; OpPop; OpJump loop
+//	end:
+func (c *Compiler) compileYieldDelegate(node *ast.YieldExpression) error {
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+	delegate := c.symbolTable.Define("$delegate")
+	c.emit(code.OpSetLocal, delegate.Index)
+	step := c.symbolTable.Define("$step")
+	field := func(s Symbol, name string) {
+		c.emit(code.OpGetLocal, s.Index)
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: name}))
+		c.emit(code.OpGetField)
+	}
+
+	loopPos := len(c.currentInstructions())
+	field(delegate, "next")
+	c.emit(code.OpCall, 0)
+	c.emit(code.OpSetLocal, step.Index)
+	field(step, "done")
+	jumpMorePos := c.emit(code.OpJumpNotTruthy, 9999)
+	field(step, "value")
+	jumpEndPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpMorePos, len(c.currentInstructions()))
+	field(step, "value")
+	c.emit(code.OpYield)
+	c.emit(code.OpPop)
+	c.emit(code.OpJump, loopPos)
+
+	c.changeOperand(jumpEndPos, len(c.currentInstructions()))
+	return nil
+}
+
+// push the class name, the superclass (or null) and a name, closure pair
+// for every method, then OpClass makes the class of them.
+// the methods are compiled in a block scope that holds the superclass as
+// "super", a keyword so it can't clash with a user's name, and take self
+// as their first parameter
+func (c *Compiler) compileClass(node *ast.ClassStatement) error {
+	c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Name.Value}))
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	defer func() { c.symbolTable = c.symbolTable.Outer }()
+
+	if node.Super != nil {
+		err := c.Compile(node.Super)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.emit(code.OpNull)
+	}
+	super := c.symbolTable.Define("super")
+	if super.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, super.Index)
+	} else {
+		c.emit(code.OpSetLocal, super.Index)
+	}
+	c.loadSymbol(super)
+	// like a recursive function's name. the class is bound once it's made,
+	// and a method may be made into a closure before that
+	c.symbolTable.DefineClassName(node.Name.Value)
+
+	for _, m := range node.Methods {
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: m.Name.Value}))
+		self := &ast.Identifier{Token: m.Name.Token, Value: "self"}
+		fn := &ast.FunctionLiteral{
+			Token:      m.Function.Token,
+			Parameters: append([]*ast.Identifier{self}, m.Function.Parameters...),
+			Body:       m.Function.Body,
+			Generator:  m.Function.Generator,
+		}
+		err := c.Compile(fn)
+		if err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpClass, len(node.Methods))
+	return nil
+}
+
+// the struct type an identifier is declared as, e.g. Point after struct Point { x, y }
+func (c *Compiler) constructor(exp ast.Expression) *object.StructType {
+	ident, ok := exp.(*ast.Identifier)
+	if !ok {
+		return nil
+	}
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok {
+		return nil
+	}
+	return symbol.Constructs
+}
+
+// the struct type a value is known to have, e.g. Point for Point(1, 2)
+func (c *Compiler) constructedStruct(exp ast.Expression) *object.StructType {
+	call, ok := exp.(*ast.CallExpression)
+	if !ok {
+		return nil
+	}
+	return c.constructor(call.Function)
+}
+
+// the offset of a field when the object is an identifier known to hold a struct.
+// a field the struct doesn't have is looked up at runtime, which fails like
+// the evaluator does, and only if the code runs
+func (c *Compiler) structField(node *ast.MemberExpression) (int, bool) {
+	ident, ok := node.Object.(*ast.Identifier)
+	if !ok {
+		return 0, false
+	}
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok || symbol.Struct == nil {
+		return 0, false
+	}
+	offset, ok := symbol.Struct.Offsets[node.Member.Value]
+	return offset, ok
+}
+
+// try { } catch (e) { } without finally
+//
+//	OpTry catch; try block; OpEndTry; OpJump end
+//	catch: set e (or pop); catch block
+//	end:
+func (c *Compiler) compileTryCatch(node *ast.TryExpression) error {
+	if node.Catch == nil {
+		return c.compileBlock(node.Block)
+	}
+	tryPos := c.emit(code.OpTry, 9999)
+	c.pushExit(nil)
+	err := c.compileBlock(node.Block)
+	if err != nil {
+		return err
+	}
+	c.popExit()
+	c.emit(code.OpEndTry)
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	// the handler is gone by now, the thrown value is on the stack
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	if node.Param != nil {
+		symbol := c.symbolTable.Define(node.Param.Value)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+	} else {
+		c.emit(code.OpPop)
+	}
+	err = c.Compile(node.Catch)
+	c.symbolTable = c.symbolTable.Outer
+	if err != nil {
+		return err
+	}
+	if endsWithExpression(node.Catch) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// the finally block is compiled once for every way out of the try:
+// falling off its end, something thrown, and every return inside
+//
+//	OpTry rethrow; try/catch; OpEndTry; finally; OpPop; OpJump end
+//	rethrow: finally; OpPop; OpThrow
+//	end:
+func (c *Compiler) compileTryFinally(node *ast.TryExpression) error {
+	c.pushExit(node.Finally)
+	tryPos := c.emit(code.OpTry, 9999)
+	c.pushExit(nil)
+	err := c.compileTryCatch(node)
+	if err != nil {
+		return err
+	}
+	c.popExit()
+	c.emit(code.OpEndTry)
+	c.popExit()
+	err = c.compileFinally(node.Finally)
+	if err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+	err = c.compileFinally(node.Finally)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpThrow)
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// run a finally block for its effects, leaving the stack as it was
+func (c *Compiler) compileFinally(finally *ast.BlockStatement) error {
+	err := c.compileBlock(finally)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	return nil
+}
+
+func (c *Compiler) pushExit(finally *ast.BlockStatement) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.exits = append(scope.exits, tryExit{finally: finally})
+}
+
+func (c *Compiler) popExit() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.exits = scope.exits[:len(scope.exits)-1]
+}
+
+// before a return leaves the try blocks it's in, remove their handlers
+// and run their finally blocks, innermost first
+func (c *Compiler) compileExits() error {
+	scope := &c.scopes[c.scopeIndex]
+	exits := scope.exits
+	defer func() { c.scopes[c.scopeIndex].exits = exits }()
+	for i := len(exits) - 1; i >= 0; i-- {
+		if exits[i].finally == nil {
+			c.emit(code.OpEndTry)
+			continue
+		}
+		// a return inside the finally block only leaves the outer try blocks
+		c.scopes[c.scopeIndex].exits = exits[:i]
+		err := c.compileFinally(exits[i].finally)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// turn every call whose result goes straight into OpReturnValue,
+// maybe by way of jumps like at the end of an if's branch, into OpTailCall.
+// pipeline stages stay calls, their frame is where an error is pointed at
+func markTailCalls(ins code.Instructions, stages map[int]string) {
+	for pos := 0; pos < len(ins); {
+		op := code.Opcode(ins[pos])
+		def, err := code.Lookup(ins[pos])
+		if err != nil {
+			return
+		}
+		width := 1
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		_, stage := stages[pos+width-1]
+		if !stage && returnsAt(ins, pos+width) {
+			switch op {
+			case code.OpCall:
+				ins[pos] = byte(code.OpTailCall)
+			case code.OpCallKeywords:
+				ins[pos] = byte(code.OpTailCallKeywords)
+			}
+		}
+		pos += width
+	}
+}
+
+// whether running from pos returns right away
+func returnsAt(ins code.Instructions, pos int) bool {
+	// a jump back could loop forever, there are no more jumps than bytes
+	for hops := 0; pos < len(ins) && hops < len(ins); hops++ {
+		switch code.Opcode(ins[pos]) {
+		case code.OpReturnValue:
+			return true
+		case code.OpJump:
+			pos = int(code.ReadUint16(ins[pos+1:]))
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// remember which pipeline stage the call just emitted belongs to.
+// it's keyed by the last byte of the call instruction,
+// since that's where the frame's ip rests during the call
+func (c *Compiler) addStage(node *ast.CallExpression) {
+	scope := &c.scopes[c.scopeIndex]
+	if scope.stages == nil {
+		scope.stages = make(map[int]string)
+	}
+	pos := len(scope.instructions) - 1
+	scope.stages[pos] = fmt.Sprintf("%s at %d:%d",
+		node.Function, node.Token.Line, node.Token.Column)
+}
+
+// resolve a name used in an expression. in the value of a let defining it, outside
+// any function in the value, it means what it did before the let
+func (c *Compiler) resolve(name string) (Symbol, bool) {
+	for i := len(c.lets) - 1; i >= 0; i-- {
+		let := c.lets[i]
+		if let.name != name {
+			continue
+		}
+		if let.depth != c.functionDepth {
+			break
+		}
+		defined := let.table.store[name]
+		if let.had {
+			let.table.store[name] = let.before
+		} else {
+			delete(let.table.store, name)
+		}
+		symbol, ok := c.symbolTable.Resolve(name)
+		let.table.store[name] = defined
+		return symbol, ok
+	}
+	return c.symbolTable.Resolve(name)
+}
+
+// a comprehension compiles to a closure without parameters that's called right away,
+// so the loop variables stay local to it. the result (an empty array or hash, made by
+// newOp) and the iterator live in hidden locals. collect gets the result on the stack
+// and adds the current element to it
+//
+//	loop: get iterator; OpIterNext end; set variables; [condition; OpJumpNotTruthy loop]
+//	      get result; collect; OpJump loop
+//	end:  get result; OpReturnValue
+func (c *Compiler) compileComprehension(clause *ast.ComprehensionClause,
+	newOp code.Opcode, collect func() error) error {
+	c.enterScope()
+
+	c.emit(newOp, 0)
+	result := c.symbolTable.Define("$result")
+	c.emit(code.OpSetLocal, result.Index)
+
+	// compiled before the variables are defined, they don't shadow the iterable
+	err := c.Compile(clause.Iterable)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+	iterator := c.symbolTable.Define("$iterator")
+	c.emit(code.OpSetLocal, iterator.Index)
+
+	variables := make([]Symbol, len(clause.Variables))
+	for i, v := range clause.Variables {
+		variables[i] = c.symbolTable.Define(v.Value)
+	}
+
+	loopStart := c.emit(code.OpGetLocal, iterator.Index)
+	iterNextPos := c.emit(code.OpIterNext, 9999, len(variables))
+	// the values are pushed in order, so the last one is on top
+	for i := len(variables) - 1; i >= 0; i-- {
+		c.emit(code.OpSetLocal, variables[i].Index)
+	}
+
+	if clause.Condition != nil {
+		err := c.Compile(clause.Condition)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJumpNotTruthy, loopStart)
+	}
+
+	c.emit(code.OpGetLocal, result.Index)
+	err = collect()
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpJump, loopStart)
+
+	afterLoopPos := c.emit(code.OpGetLocal, result.Index)
+	c.replaceInstruction(iterNextPos, code.Make(code.OpIterNext, afterLoopPos, len(variables)))
+	c.emit(code.OpReturnValue)
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numLocals()
+	stages := c.scopes[c.scopeIndex].stages
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadSymbol(s)
+	}
+	compiledFn := &object.CompiledFunction{
+		Instructions: instructions,
+		NumLocals:    numLocals,
+		Stages:       stages,
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+	c.emit(code.OpCall, 0)
+	return nil
+}
+
+// for (x in xs) { body } in a function is compiled inline, not as a closure
+// like a comprehension, so a return or a yield in the body is the
+// function's. the loop has a block scope of its own
+//
+//	xs; OpIter; set $iterator
+//	loop: get $iterator; OpIterNext end; set x
+//	body; OpPop; OpJump loop
+//	end:
+func (c *Compiler) compileFor(node *ast.ForStatement) error {
+	// compiled before the variables are defined, they don't shadow the iterable
+	err := c.Compile(node.Iterable)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	defer func() { c.symbolTable = c.symbolTable.Outer }()
+	set := func(symbol Symbol) {
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+	}
+	iterator := c.symbolTable.Define("$iterator")
+	set(iterator)
+
+	// at the top level the variables would be globals, one slot every
+	// iteration reuses, and a closure made in the body reads a global when
+	// it's called. so there the body is a function of the variables,
+	// called every iteration, which gives each iteration its own bindings
+	//
+	//	fn(x) { body }; set $body
+	//	loop: get $body; get $iterator; OpIterNext end; OpCall; OpPop; OpJump loop
+	//	end: OpPop; OpNull; OpPop
+	//
+	// a return in the body can't leave the program, so it's an error
+	if c.scopeIndex == 0 {
+		c.loopBody = true
+		err := c.Compile(&ast.FunctionLiteral{Token: node.Token, Parameters: node.Variables, Body: node.Body})
+		if err != nil {
+			return err
+		}
+		body := c.symbolTable.Define("$body")
+		set(body)
+		loopStart := c.emit(code.OpGetGlobal, body.Index)
+		c.loadSymbol(iterator)
+		iterNextPos := c.emit(code.OpIterNext, 9999, len(node.Variables))
+		c.emit(code.OpCall, len(node.Variables))
+		c.emit(code.OpPop)
+		c.emit(code.OpJump, loopStart)
+		// the body is left on the stack. the loop's value is null, not the body
+		afterLoopPos := c.emit(code.OpPop)
+		c.emit(code.OpNull)
+		c.emit(code.OpPop)
+		c.replaceInstruction(iterNextPos, code.Make(code.OpIterNext, afterLoopPos, len(node.Variables)))
+		return nil
+	}
+
+	variables := make([]Symbol, len(node.Variables))
+	for i, v := range node.Variables {
+		variables[i] = c.symbolTable.Define(v.Value)
+	}
+
+	loopStart := len(c.currentInstructions())
+	c.loadSymbol(iterator)
+	iterNextPos := c.emit(code.OpIterNext, 9999, len(variables))
+	// the values are pushed in order, so the last one is on top
+	for i := len(variables) - 1; i >= 0; i-- {
+		set(variables[i])
+	}
+
+	err = c.compileBlock(node.Body)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	c.emit(code.OpJump, loopStart)
+
+	afterLoopPos := len(c.currentInstructions())
+	c.replaceInstruction(iterNextPos, code.Make(code.OpIterNext, afterLoopPos, len(variables)))
+	return nil
+}
+
+// defer f(a, b: 1) queues f and its arguments on the frame, to be called
+// when it returns. the names of the keyword arguments are a constant,
+// empty when there are none
+//
+//	f; [a, 1]; OpDefer names
+func (c *Compiler) compileDefer(call *ast.CallExpression) error {
+	err := c.Compile(call.Function)
+	if err != nil {
+		return err
+	}
+	args := argumentValues(call.Arguments)
+	if hasSpread(args) {
+		err := c.compileSpreadList(code.OpArray, args)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, a := range args {
 			err := c.Compile(a)
 			if err != nil {
 				return err
 			}
 		}
+		c.emit(code.OpArray, len(args))
+	}
+	c.emit(code.OpDefer, c.addNames(keywordNames(call.Arguments)))
+	return nil
+}
+
+// the names of a call's keyword arguments, nil when it has none
+func keywordNames(args []ast.Expression) []string {
+	var names []string
+	for _, a := range args {
+		if kw, ok := a.(*ast.KeywordArgument); ok {
+			names = append(names, kw.Name.Value)
+		}
+	}
+	return names
+}
+
+// the arguments of a call with the keyword arguments' values in their place
+func argumentValues(args []ast.Expression) []ast.Expression {
+	values := make([]ast.Expression, len(args))
+	for i, a := range args {
+		if kw, ok := a.(*ast.KeywordArgument); ok {
+			a = kw.Value
+		}
+		values[i] = a
+	}
+	return values
+}
+
+// the constant with the names of a call's keyword arguments
+func (c *Compiler) addNames(names []string) int {
+	elements := []object.Object{}
+	for _, name := range names {
+		elements = append(elements, &object.String{Value: name})
+	}
+	return c.addConstant(&object.Array{Elements: elements})
+}
+
+func parameterNames(params []*ast.Identifier) []string {
+	names := []string{}
+	for _, p := range params {
+		names = append(names, p.Value)
+	}
+	return names
+}
+
+func hasSpread(exps []ast.Expression) bool {
+	for _, e := range exps {
+		if _, ok := e.(*ast.SpreadElement); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// start with an empty array (or set, by newOp) and extend it by runs of plain
+// elements and by every spread, e.g. [...a, 1, 2] compiles like [] + a + [1, 2]
+func (c *Compiler) compileSpreadList(newOp code.Opcode, elements []ast.Expression) error {
+	c.emit(newOp, 0)
+	pending := 0
+	flush := func() {
+		if pending > 0 {
+			c.emit(newOp, pending)
+			c.emit(code.OpExtend)
+			pending = 0
+		}
+	}
+	for _, el := range elements {
+		if spread, ok := el.(*ast.SpreadElement); ok {
+			flush()
+			err := c.Compile(spread.Value)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpExtend)
+			continue
+		}
+		err := c.Compile(el)
+		if err != nil {
+			return err
+		}
+		pending++
+	}
+	flush()
+	return nil
+}
 
-		c.emit(code.OpCall, len(node.Arguments))
+// same as compileSpreadList, merging hashes instead
+func (c *Compiler) compileSpreadHash(node *ast.HashLiteral, keys []ast.Expression) error {
+	c.emit(code.OpHash, 0)
+	pending := 0
+	flush := func() {
+		if pending > 0 {
+			c.emit(code.OpHash, pending)
+			c.emit(code.OpExtend)
+			pending = 0
+		}
+	}
+	for _, k := range keys {
+		if spread, ok := k.(*ast.SpreadElement); ok {
+			flush()
+			err := c.Compile(spread.Value)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpExtend)
+			continue
+		}
+		err := c.Compile(k)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(node.Pairs[k])
+		if err != nil {
+			return err
+		}
+		pending += 2
 	}
+	flush()
 	return nil
 }
 
@@ -457,5 +1494,7 @@ func (c *Compiler) loadSymbol(s Symbol) {
 		c.emit(code.OpGetFree, s.Index)
 	case FunctionScope:
 		c.emit(code.OpCurrentClosure)
+	case ClassScope:
+		c.emit(code.OpCurrentClass)
 	}
 }
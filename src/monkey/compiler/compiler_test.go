@@ -154,6 +154,30 @@ func testConstants(t *testing.T,
 			if err != nil {
 				return fmt.Errorf("constant %d - testStringObject failed: %s", i, err)
 			}
+		case []string:
+			array, ok := actual[i].(*object.Array)
+			if !ok || len(array.Elements) != len(constant) {
+				return fmt.Errorf("constant %d - wrong array. want=%v, got=%s",
+					i, constant, actual[i].Inspect())
+			}
+			for j, s := range constant {
+				err := testStringObject(s, array.Elements[j])
+				if err != nil {
+					return fmt.Errorf("constant %d - testStringObject failed: %s", i, err)
+				}
+			}
+		case *object.StructType:
+			st, ok := actual[i].(*object.StructType)
+			if !ok || st.Inspect() != constant.Inspect() {
+				return fmt.Errorf("constant %d - wrong struct type. want=%s, got=%s",
+					i, constant.Inspect(), actual[i].Inspect())
+			}
+		case *object.Enum:
+			enum, ok := actual[i].(*object.Enum)
+			if !ok || enum.Inspect() != constant.Inspect() {
+				return fmt.Errorf("constant %d - wrong enum. want=%s, got=%s",
+					i, constant.Inspect(), actual[i].Inspect())
+			}
 		case []code.Instructions:
 			fn, ok := actual[i].(*object.CompiledFunction)
 			if !ok {
@@ -368,78 +392,1118 @@ one;
 
 }
 
+func TestConstStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+            const one = 1;
+            one;
+            `,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConstReassignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const a = 1; let a = 2;", "cannot reassign const a"},
+		{"const a = 1; const a = 2;", "cannot reassign const a"},
+		{"fn() { const b = 1; let b = 2; }", "cannot reassign const b"},
+		// shadowing in an enclosed scope is a new binding
+		{"const a = 1; fn() { let a = 2; a }", ""},
+		{"const a = 1; fn(a) { a }", ""},
+		{"let a = 1; let a = 2; const a = 3;", ""},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
+		err := compiler.Compile(program)
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected compiler error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("expected compiler error for %q, got none", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
 func TestStringExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
 			input:             `"monkey"`,
 			expectedConstants: []interface{}{"monkey"},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"mon" + "key"`,
+			expectedConstants: []interface{}{"mon", "key"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got=%T (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q",
+			result.Value, expected)
+	}
+	return nil
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[]",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1, 2, 3]",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 3),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1 + 2, 3 - 4, 5 * 6]",
+			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpSub),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpMul),
+				code.Make(code.OpArray, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "{}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{1: 2, 3: 4, 5: 6}",
+			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpHash, 6),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{1: 2 + 3, 4: 5 * 6}",
+			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpMul),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSetLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "#{}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpSet, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "#{1, 2 + 3}",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSet, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "#{1, ...[2]}",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpSet, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSet, 1),
+				code.Make(code.OpExtend),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpExtend),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 in #{1}",
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSet, 1),
+				code.Make(code.OpIn),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestRangeExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "0..10",
+			expectedConstants: []interface{}{0, 10},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpRange, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1..=10 step 2",
+			expectedConstants: []interface{}{1, 10, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpRange, 1, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// at the top level the body is a function called every iteration
+			input: "let xs = [1]; for (x in xs) { x }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpSetGlobal, 0),
+				// 0009
+				code.Make(code.OpGetGlobal, 0),
+				// 0012
+				code.Make(code.OpIter),
+				// 0013
+				code.Make(code.OpSetGlobal, 1),
+				// 0016
+				code.Make(code.OpClosure, 1, 0),
+				// 0020
+				code.Make(code.OpSetGlobal, 2),
+				// 0023
+				code.Make(code.OpGetGlobal, 2),
+				// 0026
+				code.Make(code.OpGetGlobal, 1),
+				// 0029
+				code.Make(code.OpIterNext, 39, 1),
+				// 0033
+				code.Make(code.OpCall, 1),
+				// 0035
+				code.Make(code.OpPop),
+				// 0036
+				code.Make(code.OpJump, 23),
+				// 0039
+				code.Make(code.OpPop),
+				// 0040
+				code.Make(code.OpNull),
+				// 0041
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(xs) { for (x in xs) { return x } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002
+					code.Make(code.OpIter),
+					// 0003
+					code.Make(code.OpSetLocal, 1),
+					// 0005
+					code.Make(code.OpGetLocal, 1),
+					// 0007
+					code.Make(code.OpIterNext, 21, 1),
+					// 0011
+					code.Make(code.OpSetLocal, 2),
+					// 0013
+					code.Make(code.OpGetLocal, 2),
+					// 0015
+					code.Make(code.OpReturnValue),
+					// 0016
+					code.Make(code.OpNull),
+					// 0017
+					code.Make(code.OpPop),
+					// 0018
+					code.Make(code.OpJump, 5),
+					// 0021
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestSpreadElements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1, ...[2], 3]",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpExtend),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpExtend),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpExtend),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{...{}, 1: 2}",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpExtend),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpHash, 2),
+				code.Make(code.OpExtend),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "len(...[1])",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpExtend),
+				code.Make(code.OpCallSpread),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestKeywordArguments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "let f = fn(a, b) { a }; f(b: 1, a: 2)",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				2,
+				[]string{"b", "a"},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCallKeywords, 2, 3),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the keywords' values end the array of arguments
+			input: "let f = fn(a, b) { a }; f(...[1], b: 2)",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				2,
+				[]string{"b"},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpExtend),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpExtend),
+				code.Make(code.OpCallSpreadKeywords, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	program := parse("fn(a, b) { a }")
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	fn := compiler.Bytecode().Constants[0].(*object.CompiledFunction)
+	if fmt.Sprint(fn.Parameters) != "[a b]" {
+		t.Errorf("wrong parameter names. got=%v", fn.Parameters)
+	}
+}
+
+func TestDefer(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn() { defer len(1, x: 2); 3 }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]string{"x"},
+				3,
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpArray, 2),
+					code.Make(code.OpDefer, 2),
+					code.Make(code.OpConstant, 3),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 4, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn() { if (true) { let a = 1; a } else { let b = 2; b }; let c = 3; c }`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				3,
+				[]code.Instructions{
+					code.Make(code.OpTrue),
+					code.Make(code.OpJumpNotTruthy, 14),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpJump, 21),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let x = 1; if (true) { let x = x + 1; x }; x`,
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 26),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpJump, 27),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	compiler := New()
+	err := compiler.Compile(parse(`fn() { let a = 1; if (a) { let b = 2; let c = 3; } let d = 4; }`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	fn := compiler.Bytecode().Constants[4].(*object.CompiledFunction)
+	if fn.NumLocals != 3 {
+		t.Errorf("wrong NumLocals. want=3, got=%d", fn.NumLocals)
+	}
+
+	err = New().Compile(parse(`if (true) { let a = 1; } a`))
+	if err == nil || err.Error() != "undefined variable a" {
+		t.Errorf("expected error %q, got=%v", "undefined variable a", err)
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `import "lib.monkey" as lib; lib.x`,
+			expectedConstants: []interface{}{"lib.monkey", "x"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpImport, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGetField),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { import "lib.monkey" as lib; lib }`,
+			expectedConstants: []interface{}{
+				"lib.monkey",
+				[]code.Instructions{
+					code.Make(code.OpImport, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	compiler := New()
+	err := compiler.Compile(parse(`let a = 1; export let b = 2; export const c = 3;`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	exports := compiler.Bytecode().Exports
+	if len(exports) != 2 || exports["b"] != 1 || exports["c"] != 2 {
+		t.Errorf("wrong exports. got=%v", exports)
+	}
+
+	err = New().Compile(parse(`const m = 1; import "lib.monkey" as m;`))
+	if err == nil || err.Error() != "cannot reassign const m" {
+		t.Errorf("expected error %q, got=%v", "cannot reassign const m", err)
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "try { throw 1 } catch (e) { e }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTry, 12),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpThrow),
+				code.Make(code.OpNull),
+				code.Make(code.OpEndTry),
+				code.Make(code.OpJump, 18),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "try { 1 } finally { 2 }",
+			expectedConstants: []interface{}{1, 2, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTry, 14),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpEndTry),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 19),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpThrow),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { try { return 1 } finally { 2 } }",
+			expectedConstants: []interface{}{
+				1, 2, 2, 2,
+				[]code.Instructions{
+					code.Make(code.OpTry, 21),
+					code.Make(code.OpConstant, 0),
+					// leave the try block and run finally before returning
+					code.Make(code.OpEndTry),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpReturnValue),
+					code.Make(code.OpNull),
+					code.Make(code.OpEndTry),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpPop),
+					code.Make(code.OpJump, 26),
+					code.Make(code.OpConstant, 3),
+					code.Make(code.OpPop),
+					code.Make(code.OpThrow),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 4, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStructs(t *testing.T) {
+	point := object.NewStructType("Point", []string{"x", "y"})
+	tests := []compilerTestCase{
+		{
+			input:             "struct Point { x, y } let p = Point(1, 2); p.y; p.x = 3;",
+			expectedConstants: []interface{}{point, 1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpSetGlobal, 1),
+				// the offsets are known, no field names at runtime
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpGetStructField, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpSetStructField, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "struct Point { x, y } fn(p) { p.x }",
+			expectedConstants: []interface{}{
+				point,
+				"x",
+				[]code.Instructions{
+					// nothing is known about a parameter
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpGetField),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { struct Point { x, y } let p = Point(1, 2); fn() { p.y } }",
+			expectedConstants: []interface{}{
+				point,
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetStructField, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpCall, 2),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpClosure, 3, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 4, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// a field the struct doesn't have is left to the runtime, like the evaluator
+			input: "struct Point { x, y } let p = Point(1, 2); p.z",
+			expectedConstants: []interface{}{
+				point,
+				1,
+				2,
+				"z",
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpGetField),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"const Point = 1; struct Point { x }", "cannot reassign const Point"},
+	}
+	for _, tt := range errors {
+		err := New().Compile(parse(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong compiler error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn() { let x = yield 1; yield }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpYield),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpNull),
+					code.Make(code.OpYield),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(g) { yield* g }",
+			expectedConstants: []interface{}{
+				"next",
+				"done",
+				"value",
+				"value",
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					// loop
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpGetField),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpGetField),
+					code.Make(code.OpJumpNotTruthy, 32),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpGetField),
+					code.Make(code.OpJump, 43),
+					// more
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpConstant, 3),
+					code.Make(code.OpGetField),
+					code.Make(code.OpYield),
+					code.Make(code.OpPop),
+					code.Make(code.OpJump, 4),
+					// end
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 4, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	// the parser rejects it, a program built some other way is checked here
+	x := &ast.Identifier{Value: "x"}
+	comprehension := &ast.ArrayComprehension{
+		Element:             &ast.YieldExpression{Value: x},
+		ComprehensionClause: ast.ComprehensionClause{Variables: []*ast.Identifier{x}, Iterable: &ast.ArrayLiteral{}},
+	}
+	err := New().Compile(&ast.FunctionLiteral{Generator: true, Body: &ast.BlockStatement{
+		Statements: []ast.Statement{&ast.ExpressionStatement{Expression: comprehension}},
+	}})
+	if err == nil || err.Error() != "yield inside a comprehension" {
+		t.Errorf("expected error %q, got=%v", "yield inside a comprehension", err)
+	}
+	comp := New()
+	err = comp.Compile(parse("fn() { yield 1 }; fn() { 1 }"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	constants := comp.Bytecode().Constants
+	if !constants[1].(*object.CompiledFunction).Generator || constants[3].(*object.CompiledFunction).Generator {
+		t.Errorf("expected only the first function to be a generator")
+	}
+}
+
+func TestEnums(t *testing.T) {
+	status := object.NewEnum("Status")
+	status.AddVariant("Pending", []string{})
+	status.AddVariant("Done", []string{"result"})
+	tests := []compilerTestCase{
+		{
+			input:             "enum Status { Pending, Done(result) } Status.Pending",
+			expectedConstants: []interface{}{status, "Pending"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGetField),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"const Status = 1; enum Status { Pending }", "cannot reassign const Status"},
+	}
+	for _, tt := range errors {
+		err := New().Compile(parse(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong compiler error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestClasses(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "class A { get() { self.x } } class B extends A { get() { super.get() } }",
+			expectedConstants: []interface{}{
+				"A",
+				"get",
+				"x",
+				[]code.Instructions{
+					// self is the first parameter
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpGetField),
+					code.Make(code.OpReturnValue),
+				},
+				"B",
+				"get",
+				"get",
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 2),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 6),
+					code.Make(code.OpGetSuper),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpClass, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpGetGlobal, 2),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpClosure, 7, 0),
+				code.Make(code.OpClass, 1),
+				code.Make(code.OpSetGlobal, 3),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"super.f()", "super used outside of a class"},
+		{"fn() { super.f() }", "super used outside of a class"},
+		{"class B extends A {}", "undefined variable A"},
+		{"const A = 1; class A {}", "cannot reassign const A"},
+	}
+	for _, tt := range errors {
+		err := New().Compile(parse(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong compiler error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestComprehensions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "[x for x in [1] if x]",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpArray, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpArray, 1),
+					code.Make(code.OpIter),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpIterNext, 35, 1),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpJumpNotTruthy, 14),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpAppend),
+					code.Make(code.OpJump, 14),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "let h = {}; {k: v for k, v in h}",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpHash, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpIter),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpIterNext, 32, 2),
+					code.Make(code.OpSetLocal, 3),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpGetLocal, 3),
+					code.Make(code.OpSetIndex),
+					code.Make(code.OpPop),
+					code.Make(code.OpJump, 11),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpCall, 0),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             `"mon" + "key"`,
-			expectedConstants: []interface{}{"mon", "key"},
+			input: "fn(a) { [x for x in a] }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpArray, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpIter),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpIterNext, 26, 1),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpAppend),
+					code.Make(code.OpJump, 10),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpAdd),
+				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpPop),
 			},
 		},
 	}
 
 	runCompilerTests(t, tests)
-}
 
-func testStringObject(expected string, actual object.Object) error {
-	result, ok := actual.(*object.String)
-	if !ok {
-		return fmt.Errorf("object is not String. got=%T (%+v)", actual, actual)
+	// the loop variables are local to the comprehension
+	program := parse("[x for x in [1]]; x")
+	err := New().Compile(program)
+	if err == nil || err.Error() != "undefined variable x" {
+		t.Errorf("expected error %q, got=%v", "undefined variable x", err)
 	}
-	if result.Value != expected {
-		return fmt.Errorf("object has wrong value. got=%q, want=%q",
-			result.Value, expected)
-	}
-	return nil
 }
 
-func TestArrayLiterals(t *testing.T) {
+func TestIndexExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
-			input:             "[]",
-			expectedConstants: []interface{}{},
-			expectedInstructions: []code.Instructions{
-				code.Make(code.OpArray, 0),
-				code.Make(code.OpPop),
-			},
-		},
-		{
-			input:             "[1, 2, 3]",
-			expectedConstants: []interface{}{1, 2, 3},
+			input:             "[1, 2, 3][1 + 1]",
+			expectedConstants: []interface{}{1, 2, 3, 1, 1},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
 				code.Make(code.OpArray, 3),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpAdd),
+				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             "[1 + 2, 3 - 4, 5 * 6]",
-			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			input:             "{1: 2}[2 - 1]",
+			expectedConstants: []interface{}{1, 2, 2, 1},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpAdd),
+				code.Make(code.OpHash, 2),
 				code.Make(code.OpConstant, 2),
 				code.Make(code.OpConstant, 3),
 				code.Make(code.OpSub),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
-				code.Make(code.OpMul),
-				code.Make(code.OpArray, 3),
+				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
 			},
 		},
@@ -448,43 +1512,51 @@ func TestArrayLiterals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
-func TestHashLiterals(t *testing.T) {
+func TestSliceExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
-			input:             "{}",
-			expectedConstants: []interface{}{},
+			input:             "[1, 2][1:]",
+			expectedConstants: []interface{}{1, 2, 1},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpHash, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpNull),
+				code.Make(code.OpSlice),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             "{1: 2, 3: 4, 5: 6}",
-			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			input:             "[1, 2][:-1]",
+			expectedConstants: []interface{}{1, 2, 1},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpNull),
 				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
-				code.Make(code.OpHash, 6),
+				code.Make(code.OpMinus),
+				code.Make(code.OpSlice),
 				code.Make(code.OpPop),
 			},
 		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMemberExpressions(t *testing.T) {
+	tests := []compilerTestCase{
 		{
-			input:             "{1: 2 + 3, 4: 5 * 6}",
-			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			input:             `{"port": 80}.port`,
+			expectedConstants: []interface{}{"port", 80, "port"},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
+				code.Make(code.OpHash, 2),
 				code.Make(code.OpConstant, 2),
-				code.Make(code.OpAdd),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
-				code.Make(code.OpMul),
-				code.Make(code.OpHash, 4),
+				code.Make(code.OpGetField),
 				code.Make(code.OpPop),
 			},
 		},
@@ -493,34 +1565,28 @@ func TestHashLiterals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
-func TestIndexExpressions(t *testing.T) {
+func TestAssignExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
-			input:             "[1, 2, 3][1 + 1]",
-			expectedConstants: []interface{}{1, 2, 3, 1, 1},
+			input:             "[1][0] = 2",
+			expectedConstants: []interface{}{1, 0, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
-				code.Make(code.OpArray, 3),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpAdd),
-				code.Make(code.OpIndex),
+				code.Make(code.OpSetIndex),
 				code.Make(code.OpPop),
 			},
 		},
 		{
-			input:             "{1: 2}[2 - 1]",
-			expectedConstants: []interface{}{1, 2, 2, 1},
+			input:             "{}.port = 80",
+			expectedConstants: []interface{}{"port", 80},
 			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpHash, 2),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpSub),
-				code.Make(code.OpIndex),
+				code.Make(code.OpSetField),
 				code.Make(code.OpPop),
 			},
 		},
@@ -690,6 +1756,69 @@ let manyArg = fn(a, b, c) {a;b;c}; manyArg(24, 25, 26);
 	runCompilerTests(t, tests)
 }
 
+func TestPipeExpressions(t *testing.T) {
+	// a pipeline compiles to exactly the call it stands for
+	piped := New()
+	err := piped.Compile(parse("let f = fn(a, b) { a }; 1 |> f(2)"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	called := New()
+	err = called.Compile(parse("let f = fn(a, b) { a }; f(1, 2)"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err = testInstructions([]code.Instructions{called.Bytecode().Instructions},
+		piped.Bytecode().Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+	stages := piped.Bytecode().Stages
+	if len(stages) != 1 {
+		t.Fatalf("wrong number of stages. got=%d", len(stages))
+	}
+	for _, stage := range stages {
+		if stage != "f at 1:27" {
+			t.Errorf("wrong stage. got=%q", stage)
+		}
+	}
+}
+
+func TestArrowFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `(a, b) => a + b`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `x => { x; }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestLetStatementScopes(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -755,6 +1884,28 @@ a+b }
 				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpPop),
 			}},
+		{
+			input: `fn() { let a = [fn() { a }]; a }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpBox),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpArray, 1),
+					code.Make(code.OpFillBox, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			}},
 	}
 	runCompilerTests(t, tests)
 }
@@ -849,7 +2000,7 @@ func TestBuiltins(t *testing.T) {
 				[]code.Instructions{
 					code.Make(code.OpGetBuiltin, 0),
 					code.Make(code.OpArray, 0),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
@@ -987,6 +2138,107 @@ func TestClosures(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// the call ends up at the return by way of the jump over the else
+			input: "fn(f) { if (true) { f() } else { 2 } }",
+			expectedConstants: []interface{}{
+				2,
+				[]code.Instructions{
+					code.Make(code.OpTrue),
+					code.Make(code.OpJumpNotTruthy, 11),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpJump, 14),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(f) { return f(1) }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(f) { f(a: 1) }",
+			expectedConstants: []interface{}{
+				1,
+				[]string{"a"},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpTailCallKeywords, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the result is still needed
+			input: "fn(f) { f() + 1 }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the try has to end first
+			input: "fn(f) { try { return f() } catch (e) { 0 } }",
+			expectedConstants: []interface{}{
+				0,
+				[]code.Instructions{
+					code.Make(code.OpTry, 14),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpEndTry),
+					code.Make(code.OpReturnValue),
+					code.Make(code.OpNull),
+					code.Make(code.OpEndTry),
+					code.Make(code.OpJump, 19),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
 func TestRecursiveFunctions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -1000,7 +2252,7 @@ let countDown = fn(x) { countDown(x - 1); }; countDown(1);
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 				1},
@@ -1023,11 +2275,11 @@ let countDown = fn(x) { countDown(x - 1); }; countDown(1);
 			expectedConstants: []interface{}{
 				1,
 				[]code.Instructions{
-                    code.Make(code.OpCurrentClosure), 
+					code.Make(code.OpCurrentClosure),
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 				1,
@@ -1036,7 +2288,7 @@ let countDown = fn(x) { countDown(x - 1); }; countDown(1);
 					code.Make(code.OpSetLocal, 0),
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 2),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				}},
 			expectedInstructions: []code.Instructions{
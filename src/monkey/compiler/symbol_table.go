@@ -1,22 +1,29 @@
 package compiler
 
-
+import "sawyer.com/v9/src/monkey/object"
 
 type SymbolScope string
 
 const (
-	GlobalScope   SymbolScope = "GLOBAL"
-	LocalScope    SymbolScope = "LOCAL"
-	BuiltinScope  SymbolScope = "BUILTIN"
-	FreeScope     SymbolScope = "FREE"
-    // the name of the function we’re currently compiling.
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	FreeScope    SymbolScope = "FREE"
+	// the name of the function we’re currently compiling.
 	FunctionScope SymbolScope = "FUNCTION"
+	// the name of the class whose methods we're compiling
+	ClassScope SymbolScope = "CLASS"
 )
 
 type Symbol struct {
 	Name  string
 	Scope SymbolScope
-	Index int // symbol operand, used for setGlobal, getGlobal
+	Index int  // symbol operand, used for setGlobal, getGlobal
+	Const bool // defined by const, can't be redefined in the same scope
+	// what's known about the value at compile time: the struct it constructs,
+	// or the struct it holds, so field access can use offsets
+	Constructs *object.StructType
+	Struct     *object.StructType
 }
 
 // recursive SymbolTable, similar to  recursive environment in interpreter
@@ -26,6 +33,11 @@ type SymbolTable struct {
 	store          map[string]Symbol
 	numDefinitions int
 	FreeSymbols    []Symbol
+	// a block scope (the braces of if/else) has its own names,
+	// but its locals live in the slots of the enclosing function
+	block bool
+	// the most slots the function needs at once, finished blocks included
+	maxDefinitions int
 }
 
 func NewSymbolTable() *SymbolTable {
@@ -40,21 +52,75 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	return s
 }
 
+// a block scope starts numbering its locals where the outer scope is,
+// once the block ends its slots are free to be used again
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	s.numDefinitions = outer.numDefinitions
+	return s
+}
+
 // binding an Identifier to symbol table
 func (s *SymbolTable) Define(name string) Symbol {
-	symbol := Symbol{Name: name, Index: s.numDefinitions}
-	if s.Outer == nil {
+	symbol := Symbol{Name: name}
+	fn := s.function()
+	if fn.Outer == nil {
+		// globals are never reused, closures read them by index
+		// long after the block that defined them is done
 		symbol.Scope = GlobalScope
+		symbol.Index = fn.numDefinitions
+		fn.numDefinitions++
 	} else {
 		symbol.Scope = LocalScope
+		symbol.Index = s.numDefinitions
+		s.numDefinitions++
+		if s.numDefinitions > fn.maxDefinitions {
+			fn.maxDefinitions = s.numDefinitions
+		}
 	}
 	// fmt.Printf("Define %s in scope %s\n", name, symbol.Scope)
 	s.store[name] = symbol
-	s.numDefinitions++
 
 	return symbol
 }
 
+// the function (or global) scope a block belongs to
+func (s *SymbolTable) function() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+	return s
+}
+
+// numLocals = len(parameters) + the most locals alive at once
+func (s *SymbolTable) numLocals() int {
+	if s.maxDefinitions > s.numDefinitions {
+		return s.maxDefinitions
+	}
+	return s.numDefinitions
+}
+
+// binding an Identifier as a const
+func (s *SymbolTable) DefineConst(name string) Symbol {
+	symbol := s.Define(name)
+	symbol.Const = true
+	s.store[name] = symbol
+	return symbol
+}
+
+// record what's known about a defined symbol's value
+func (s *SymbolTable) annotate(symbol Symbol) {
+	s.store[symbol.Name] = symbol
+}
+
+// whether name is a const defined in this very scope, outer scopes are not
+// looked at since redefining a name there just shadows it
+func (s *SymbolTable) IsConst(name string) bool {
+	symbol, ok := s.store[name]
+	return ok && symbol.Const && symbol.Scope != FreeScope
+}
+
 //	func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 //		obj, ok := s.store[name]
 //		if !ok && s.Outer != nil {
@@ -73,9 +139,17 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 		if !ok {
 			return obj, ok
 		}
+		// a block shares the function's locals and free variables
+		if s.block {
+			return obj, ok
+		}
 		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
 			return obj, ok
 		}
+		// a method gets its class itself, a closure in it has it as a free variable
+		if _, method := s.Outer.store[name]; method && obj.Scope == ClassScope {
+			return obj, ok
+		}
 		// noteworthy: free variables are defined when being resolved
 		// resolve as free variables
 		free := s.defineFree(obj)
@@ -94,7 +168,8 @@ func (s *SymbolTable) defineFree(original Symbol) Symbol {
 	// original is a local in outer scope
 	s.FreeSymbols = append(s.FreeSymbols, original)
 	// save original as free in inner scope
-	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol := original
+	symbol.Index = len(s.FreeSymbols) - 1
 	symbol.Scope = FreeScope
 	s.store[original.Name] = symbol
 	return symbol
@@ -105,3 +180,11 @@ func (s *SymbolTable) DefineFunctionName(name string) Symbol {
 	s.store[name] = symbol
 	return symbol
 }
+
+// the class's name in its methods, which are made before it's bound.
+// it's defined in the scope enclosing the methods
+func (s *SymbolTable) DefineClassName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: ClassScope}
+	s.store[name] = symbol
+	return symbol
+}
@@ -141,6 +141,90 @@ func TestDefine(t *testing.T) {
 	}
 }
 
+func TestDefineConst(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	b := global.DefineConst("b")
+	expected := Symbol{Name: "b", Scope: GlobalScope, Index: 1, Const: true}
+	if b != expected {
+		t.Errorf("expected b=%+v, got=%+v", expected, b)
+	}
+	if global.IsConst("a") {
+		t.Errorf("a should not be const")
+	}
+	if !global.IsConst("b") {
+		t.Errorf("b should be const")
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	free, ok := local.Resolve("b")
+	if !ok || free.Scope != GlobalScope || !free.Const {
+		t.Errorf("expected b to resolve as global const, got=%+v", free)
+	}
+	// outer consts can be shadowed
+	if local.IsConst("b") {
+		t.Errorf("b should not be const in the enclosed scope")
+	}
+
+	inner := NewEnclosedSymbolTable(local)
+	local.DefineConst("c")
+	c, ok := inner.Resolve("c")
+	if !ok || c.Scope != FreeScope || !c.Const {
+		t.Errorf("expected c to resolve as free const, got=%+v", c)
+	}
+	if inner.IsConst("c") {
+		t.Errorf("free c should not be const in the enclosed scope")
+	}
+}
+
+func TestDefineBlockScopes(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	globalBlock := NewBlockSymbolTable(global)
+	b := globalBlock.Define("b")
+	expected := Symbol{Name: "b", Scope: GlobalScope, Index: 1}
+	if b != expected {
+		t.Errorf("expected b=%+v, got=%+v", expected, b)
+	}
+	// global slots aren't reused
+	c := global.Define("c")
+	if c.Index != 2 {
+		t.Errorf("expected c at index 2, got=%d", c.Index)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("d")
+	block := NewBlockSymbolTable(local)
+	e := block.Define("e")
+	expected = Symbol{Name: "e", Scope: LocalScope, Index: 1}
+	if e != expected {
+		t.Errorf("expected e=%+v, got=%+v", expected, e)
+	}
+	nested := NewBlockSymbolTable(block)
+	nested.Define("f")
+	// a block resolves the function's locals without making them free
+	d, ok := nested.Resolve("d")
+	if !ok || d.Scope != LocalScope || d.Index != 0 {
+		t.Errorf("expected d to resolve as local 0, got=%+v", d)
+	}
+	if _, ok := local.Resolve("e"); ok {
+		t.Errorf("e should not be visible outside its block")
+	}
+
+	// the slots of finished blocks are used again
+	g := local.Define("g")
+	if g.Index != 1 {
+		t.Errorf("expected g at index 1, got=%d", g.Index)
+	}
+	if local.numLocals() != 3 {
+		t.Errorf("expected 3 locals, got=%d", local.numLocals())
+	}
+	if len(local.FreeSymbols) != 0 {
+		t.Errorf("expected no free symbols, got=%+v", local.FreeSymbols)
+	}
+}
+
 func TestDefineResolveBuiltins(t *testing.T) {
 	global := NewSymbolTable()
 	firstLocal := NewEnclosedSymbolTable(global)
@@ -307,3 +391,26 @@ func TestShadowingFunctionName(t *testing.T) {
 			expected.Name, expected, result)
 	}
 }
+
+func TestResolveClassName(t *testing.T) {
+	global := NewSymbolTable()
+	class := NewBlockSymbolTable(global)
+	class.DefineClassName("C")
+	method := NewEnclosedSymbolTable(class)
+	closure := NewEnclosedSymbolTable(method)
+
+	expected := Symbol{Name: "C", Scope: ClassScope, Index: 0}
+	result, ok := method.Resolve("C")
+	if !ok || result != expected {
+		t.Errorf("expected C to resolve to %+v in a method, got=%+v", expected, result)
+	}
+	// a closure in a method has it as a free variable
+	expected = Symbol{Name: "C", Scope: FreeScope, Index: 0}
+	result, ok = closure.Resolve("C")
+	if !ok || result != expected {
+		t.Errorf("expected C to resolve to %+v in a closure, got=%+v", expected, result)
+	}
+	if len(closure.FreeSymbols) != 1 || closure.FreeSymbols[0].Scope != ClassScope {
+		t.Errorf("wrong free symbols. got=%+v", closure.FreeSymbols)
+	}
+}
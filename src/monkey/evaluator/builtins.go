@@ -5,10 +5,52 @@ import (
 )
 
 var builtins = map[string]*object.Builtin{
-	"len":   object.GetBuiltinByName("len"),
-	"puts":  object.GetBuiltinByName("puts"),
-	"first": object.GetBuiltinByName("first"),
-	"last":  object.GetBuiltinByName("last"),
-	"rest":  object.GetBuiltinByName("rest"),
-	"push":  object.GetBuiltinByName("push"),
+	"len":     object.GetBuiltinByName("len"),
+	"puts":    object.GetBuiltinByName("puts"),
+	"first":   object.GetBuiltinByName("first"),
+	"last":    object.GetBuiltinByName("last"),
+	"rest":    object.GetBuiltinByName("rest"),
+	"push":    object.GetBuiltinByName("push"),
+	"delete":  object.GetBuiltinByName("delete"),
+	"channel": object.GetBuiltinByName("channel"),
+	"send":    object.GetBuiltinByName("send"),
+	"recv":    object.GetBuiltinByName("recv"),
+	"close":   object.GetBuiltinByName("close"),
+
+	"union":        object.GetBuiltinByName("union"),
+	"intersection": object.GetBuiltinByName("intersection"),
+	"difference":   object.GetBuiltinByName("difference"),
+}
+
+// spawn and eval reach builtins, so they're added here. so does iterate,
+// which lets the builtins taking collections take any iterable
+func init() {
+	for name, builtin := range builtins {
+		builtins[name] = object.BindIterate(name, builtin, iterate)
+	}
+	builtins["spawn"] = &object.Builtin{Fn: spawn}
+	// a call expression passes eval the caller's environment. called any
+	// other way, e.g. by spawn, it only sees what env binds
+	builtins["eval"] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return evalSource(args, object.NewEnvironment())
+	}}
+}
+
+// spawn(f, args...) applies f on a goroutine of its own.
+// its environments are shared, they're locked
+func spawn(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want=at least 1")
+	}
+	switch args[0].(type) {
+	case *object.Function, *object.Builtin, *object.BoundMethod, *object.Class,
+		*object.StructType, *object.VariantType:
+	default:
+		return newError("argument to `spawn` must be a function, got %s", args[0].Type())
+	}
+	task := object.NewTask()
+	go func() {
+		task.Finish(applyFunction(args[0], args[1:]))
+	}()
+	return task
 }
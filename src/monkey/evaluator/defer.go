@@ -0,0 +1,61 @@
+package evaluator
+
+import (
+	"sawyer.com/v9/src/monkey/ast"
+	"sawyer.com/v9/src/monkey/object"
+)
+
+// the calls a function's activation deferred. a function with a defer
+// statement binds them in its environment as "defer", a keyword so it
+// can't clash with a user's name
+type deferred struct {
+	calls []deferredCall
+}
+
+func (d *deferred) Type() object.ObjectType { return "DEFERRED" }
+func (d *deferred) Inspect() string         { return "deferred calls" }
+
+// a call queued by defer, with its arguments evaluated already
+type deferredCall struct {
+	fn       object.Object
+	args     []object.Object
+	keywords []string
+}
+
+func evalDeferStatement(node *ast.DeferStatement, env *object.Environment) object.Object {
+	function := Eval(node.Call.Function, env)
+	if isError(function) {
+		return function
+	}
+	args := evalExpressions(node.Call.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+	d, ok := env.Get("defer")
+	if !ok {
+		return newError("defer outside of a function")
+	}
+	list := d.(*deferred)
+	list.calls = append(list.calls, deferredCall{
+		fn: function, args: args, keywords: keywordNames(node.Call.Arguments)})
+	return nil
+}
+
+// run the calls fn's activation in env deferred, the last one first, once
+// its result is known. a call in tail position is applied before them.
+// an error from a deferred call replaces the result, and the rest still run
+func runDeferred(fn *object.Function, env *object.Environment, result object.Object) object.Object {
+	if !fn.Defers {
+		return result
+	}
+	result = trampoline(result)
+	d, _ := env.Get("defer")
+	calls := d.(*deferred).calls
+	for i := len(calls) - 1; i >= 0; i-- {
+		out := trampoline(callFunction(calls[i].fn, calls[i].args, calls[i].keywords))
+		if isError(out) {
+			result = out
+		}
+	}
+	return result
+}
@@ -0,0 +1,54 @@
+package evaluator
+
+import (
+	"strings"
+
+	"sawyer.com/v9/src/monkey/ast"
+	"sawyer.com/v9/src/monkey/lexer"
+	"sawyer.com/v9/src/monkey/object"
+	"sawyer.com/v9/src/monkey/parser"
+)
+
+// whether call calls eval, which needs the caller's environment
+func isEval(fn object.Object, call *ast.CallExpression) bool {
+	return fn == builtins["eval"] && keywordNames(call.Arguments) == nil
+}
+
+// eval(src, env?) evaluates src in an environment of its own, enclosed by
+// the globals of the program or module env is in, with env's entries bound.
+// it gives what src's last expression or return does. a parse error is
+// thrown like a runtime error
+func evalSource(args []object.Object, env *object.Environment) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	src, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `eval` must be STRING, got %s", args[0].Type())
+	}
+	scope := object.NewEnclosedEnvironment(env.Outermost())
+	if len(args) == 2 {
+		bindings, ok := args[1].(*object.Hash)
+		if !ok {
+			return newError("env of `eval` must be HASH, got %s", args[1].Type())
+		}
+		for _, pair := range bindings.OrderedPairs() {
+			name, ok := pair.Key.(*object.String)
+			if !ok {
+				return newError("env of `eval` must have STRING keys, got %s", pair.Key.Type())
+			}
+			scope.Set(name.Value, pair.Value)
+		}
+	}
+
+	p := parser.New(lexer.New(src.Value))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newError("eval: %s", strings.Join(p.Errors(), "; "))
+	}
+	result := Eval(program, scope)
+	if result == nil {
+		return NULL
+	}
+	return result
+}
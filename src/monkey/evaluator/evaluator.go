@@ -5,6 +5,7 @@ import (
 
 	"sawyer.com/v9/src/monkey/ast"
 	"sawyer.com/v9/src/monkey/object"
+	"sawyer.com/v9/src/monkey/token"
 )
 
 var (
@@ -25,23 +26,88 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		// whatever unwraps the return applies a call returned here
+		val := evalTail(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
+		if env.IsConst(node.Name.Value) {
+			return newError("cannot reassign const %s", node.Name.Value)
+		}
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if node.Const {
+			env.SetConst(node.Name.Value, val)
+		} else {
+			env.Set(node.Name.Value, val)
+		}
+	case *ast.DeferStatement:
+		return evalDeferStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		// propagates like an error until a try catches it
+		return &object.Error{Message: "uncaught exception: " + val.Inspect(), Thrown: val}
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+	case *ast.StructStatement:
+		if env.IsConst(node.Name.Value) {
+			return newError("cannot reassign const %s", node.Name.Value)
+		}
+		fields := []string{}
+		for _, f := range node.Fields {
+			fields = append(fields, f.Value)
+		}
+		env.Set(node.Name.Value, object.NewStructType(node.Name.Value, fields))
+	case *ast.EnumStatement:
+		if env.IsConst(node.Name.Value) {
+			return newError("cannot reassign const %s", node.Name.Value)
+		}
+		enum := object.NewEnum(node.Name.Value)
+		for _, v := range node.Variants {
+			fields := []string{}
+			for _, f := range v.Fields {
+				fields = append(fields, f.Value)
+			}
+			enum.AddVariant(v.Name.Value, fields)
+		}
+		env.Set(node.Name.Value, enum)
+	case *ast.ClassStatement:
+		if env.IsConst(node.Name.Value) {
+			return newError("cannot reassign const %s", node.Name.Value)
+		}
+		class := evalClassStatement(node, env)
+		if isError(class) {
+			return class
+		}
+		env.Set(node.Name.Value, class)
+	case *ast.SuperExpression:
+		return evalSuperExpression(node, env)
+	case *ast.YieldExpression:
+		return evalYieldExpression(node, env)
+	case *ast.ImportStatement:
+		if env.IsConst(node.Name.Value) {
+			return newError("cannot reassign const %s", node.Name.Value)
+		}
+		module, err := Modules.Import(node.Path)
+		if err != nil {
+			return newError("%s", err)
+		}
+		env.Set(node.Name.Value, module)
 	case *ast.FunctionLiteral:
 		// this is how closure was implemented
 		// when meet a function definition, save the current env for the function
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Parameters: params, Env: env, Body: body, Generator: node.Generator, Defers: node.Defers}
 	case *ast.CallExpression:
 		// called by identifier or function literal
 		// get function literal
@@ -54,13 +120,31 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		var result object.Object
+		if isEval(function, node) {
+			result = evalSource(args, env)
+		} else {
+			result = trampoline(callFunction(function, args, keywordNames(node.Arguments)))
+		}
+		if node.Token.Type == token.PIPE && isError(result) {
+			// point the error at the pipeline stage that failed
+			errObj := result.(*object.Error)
+			return &object.Error{
+				Message: fmt.Sprintf("pipeline stage %s at %d:%d: %s", node.Function,
+					node.Token.Line, node.Token.Column, errObj.Message),
+				Thrown: errObj.Thrown,
+			}
+		}
+		return result
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 		// Prefix expressions
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInt{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
@@ -72,6 +156,66 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.Array{Elements: elements}
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
+	case *ast.SetLiteral:
+		return evalSetLiteral(node, env)
+	case *ast.SetComprehension:
+		set := object.NewSet()
+		err := evalComprehension(&node.ComprehensionClause, env, func(loopEnv *object.Environment) object.Object {
+			element := Eval(node.Element, loopEnv)
+			if isError(element) {
+				return element
+			}
+			err := set.Add(element)
+			if err != nil {
+				return newError("%s", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return set
+	case *ast.ArrayComprehension:
+		elements := []object.Object{}
+		err := evalComprehension(&node.ComprehensionClause, env, func(loopEnv *object.Environment) object.Object {
+			element := Eval(node.Element, loopEnv)
+			if isError(element) {
+				return element
+			}
+			elements = append(elements, element)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return &object.Array{Elements: elements}
+	case *ast.HashComprehension:
+		pairs := make(map[object.HashKey]object.HashPair)
+		err := evalComprehension(&node.ComprehensionClause, env, func(loopEnv *object.Environment) object.Object {
+			key := Eval(node.Key, loopEnv)
+			if isError(key) {
+				return key
+			}
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", key.Type())
+			}
+			value := Eval(node.Value, loopEnv)
+			if isError(value) {
+				return value
+			}
+			pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return &object.Hash{Pairs: pairs}
+	case *ast.KeywordArgument:
+		// evalExpressions evaluates it to its value, keywordNames has its name
+		return Eval(node.Value, env)
+	case *ast.SpreadElement:
+		return newError("spread is only allowed in array, hash and set literals and calls")
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
 		if isError(right) {
@@ -91,6 +235,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 
 		return evalInfixExpression(node.Operator, left, right)
+	case *ast.RangeExpression:
+		return evalRangeExpression(node, env)
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
@@ -101,6 +247,16 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return index
 		}
 		return evalIndexExpression(left, index)
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+	case *ast.MemberExpression:
+		left := Eval(node.Object, env)
+		if isError(left) {
+			return left
+		}
+		return evalMemberExpression(left, node.Member.Value)
 	}
 
 	return nil
@@ -152,17 +308,70 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	if !object.IsInteger(right) {
 		return newError("unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	return object.NegateInteger(right)
+}
+
+// structs are equal when their fields are
+func evalStructInfixExpression(operator string, left, right object.Object) object.Object {
+	l := left.(*object.Struct)
+	r := right.(*object.Struct)
+	switch operator {
+	case "==":
+		return nativeBoolToBooleanObject(l.Equal(r))
+	case "!=":
+		return nativeBoolToBooleanObject(!l.Equal(r))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// sets are equal when they have the same elements
+func evalSetInfixExpression(operator string, left, right object.Object) object.Object {
+	l := left.(*object.Set)
+	r := right.(*object.Set)
+	switch operator {
+	case "==":
+		return nativeBoolToBooleanObject(l.Equal(r))
+	case "!=":
+		return nativeBoolToBooleanObject(!l.Equal(r))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// variants are equal when they're the same variant with equal values
+func evalVariantInfixExpression(operator string, left, right object.Object) object.Object {
+	l := left.(*object.Variant)
+	r := right.(*object.Variant)
+	switch operator {
+	case "==":
+		return nativeBoolToBooleanObject(l.Equal(r))
+	case "!=":
+		return nativeBoolToBooleanObject(!l.Equal(r))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
 }
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
 	switch {
-	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+	case operator == "in":
+		found, err := object.Contains(right, left)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return nativeBoolToBooleanObject(found)
+	case object.IsInteger(left) && object.IsInteger(right):
 		return evalIntegerInfixExpression(operator, left, right)
+	case left.Type() == object.STRUCT_OBJ && right.Type() == object.STRUCT_OBJ:
+		return evalStructInfixExpression(operator, left, right)
+	case left.Type() == object.VARIANT_OBJ && right.Type() == object.VARIANT_OBJ:
+		return evalVariantInfixExpression(operator, left, right)
+	case left.Type() == object.SET_OBJ && right.Type() == object.SET_OBJ && operator != "in":
+		return evalSetInfixExpression(operator, left, right)
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
@@ -181,25 +390,22 @@ func evalIntegerInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
 	switch operator {
-	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
-	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+	case "+", "-", "*", "/":
+		// an overflow makes a BigInt
+		result, err := object.IntegerArithmetic(operator, left, right)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return result
 	case "<":
-		return nativeBoolToBooleanObject(leftVal < rightVal)
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) < 0)
 	case ">":
-		return nativeBoolToBooleanObject(leftVal > rightVal)
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) > 0)
 	case "==":
-		return nativeBoolToBooleanObject(leftVal == rightVal)
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) == 0)
 	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) != 0)
 	default:
 		return newError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
@@ -212,15 +418,57 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 		// fmt.Println("evalIfExpression gets an error.")
 		return condition
 	}
+	// each block gets its own environment, lets inside don't leak out
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return evalBlockValue(ie.Consequence, object.NewEnclosedEnvironment(env))
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return evalBlockValue(ie.Alternative, object.NewEnclosedEnvironment(env))
 	} else {
 		return NULL
 	}
 }
 
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	// a call returned inside the try is applied inside it
+	result := forceReturn(evalBlockValue(te.Block, object.NewEnclosedEnvironment(env)))
+	if errObj, ok := result.(*object.Error); ok && te.Catch != nil {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		if te.Param != nil {
+			catchEnv.Set(te.Param.Value, thrownValue(errObj))
+		}
+		result = forceReturn(evalBlockValue(te.Catch, catchEnv))
+	}
+	if te.Finally != nil {
+		// runs whatever happened, only an error or a return of its own
+		// replaces the result
+		finally := Eval(te.Finally, object.NewEnclosedEnvironment(env))
+		if finally != nil {
+			rt := finally.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return finally
+			}
+		}
+	}
+	return result
+}
+
+// what a catch gets, the value of a throw or {"message": "..."} for a runtime error
+func thrownValue(errObj *object.Error) object.Object {
+	if errObj.Thrown != nil {
+		return errObj.Thrown
+	}
+	return object.ErrorValue(errObj.Message)
+}
+
+// a block that is empty or ends with a let is null
+func evalBlockValue(block *ast.BlockStatement, env *object.Environment) object.Object {
+	result := Eval(block, env)
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -241,7 +489,7 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 		result = Eval(statement, env)
 		switch result := result.(type) {
 		case *object.ReturnValue:
-			return result.Value
+			return trampoline(result.Value)
 		case *object.Error:
 			return result
 		}
@@ -295,6 +543,26 @@ func evalExpressions(
 ) []object.Object {
 	var result []object.Object
 	for _, e := range exps {
+		// [...a, 1], f(...args)
+		if spread, ok := e.(*ast.SpreadElement); ok {
+			evaluated := Eval(spread.Value, env)
+			if isError(evaluated) {
+				return []object.Object{evaluated}
+			}
+			// anything iterable
+			iterator, errObj := iterate(evaluated)
+			if errObj != nil {
+				return []object.Object{newError("cannot spread %s, want an iterable", evaluated.Type())}
+			}
+			for value, ok := iterator.NextValue(); ok; value, ok = iterator.NextValue() {
+				result = append(result, value)
+			}
+			err := iteratorError(iterator)
+			if err != nil {
+				return []object.Object{err}
+			}
+			continue
+		}
 		evaluated := Eval(e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
@@ -304,33 +572,140 @@ func evalExpressions(
 	return result
 }
 
+// the names of a call's keyword arguments, nil when it has none.
+// evalExpressions puts their values last
+func keywordNames(args []ast.Expression) []string {
+	var names []string
+	for _, a := range args {
+		if kw, ok := a.(*ast.KeywordArgument); ok {
+			names = append(names, kw.Name.Value)
+		}
+	}
+	return names
+}
+
 func applyFunction(fn object.Object, args []object.Object) object.Object {
+	return trampoline(callFunction(fn, args, nil))
+}
+
+// call fn, a call in tail position of its body is handed back as a tailCall.
+// keywords name the last of args, when the call has keyword arguments
+func callFunction(fn object.Object, args []object.Object, keywords []string) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
 		// this is how closure was implemented
 		// use the env where the function was defined
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
+		extendedEnv, err := extendFunctionEnv(fn, args, keywords)
+		if err != nil {
+			return err
+		}
+		if fn.Generator {
+			return newGenerator(fn, extendedEnv)
+		}
+		evaluated := evalFunctionBody(fn.Body, extendedEnv)
 		// when meeting the return statement, gotta unwrap it
-		return unwrapReturnValue(evaluated)
+		return runDeferred(fn, extendedEnv, unwrapReturnValue(evaluated))
 	case *object.Builtin:
+		if keywords != nil {
+			return newError("builtin functions take no keyword arguments")
+		}
 		if result := fn.Fn(args...); result != nil {
 			return result
 		}
 		return NULL
+	case *object.Class:
+		// calling a class makes an instance and calls init on it, if there's one
+		instance := object.NewInstance(fn)
+		init, ok := fn.Lookup("init")
+		if !ok {
+			if len(args) != 0 {
+				return newError("wrong number of arguments: want=0, got=%d", len(args))
+			}
+			return instance
+		}
+		bound := &object.BoundMethod{Receiver: instance, Method: init, Name: "init"}
+		result := trampoline(callFunction(bound, args, keywords))
+		if isError(result) {
+			return result
+		}
+		return instance
+	case *object.BoundMethod:
+		method := fn.Method.(*object.Function)
+		extendedEnv, err := extendFunctionEnv(method, args, keywords)
+		if err != nil {
+			return err
+		}
+		extendedEnv.Set("self", fn.Receiver)
+		if method.Generator {
+			return newGenerator(method, extendedEnv)
+		}
+		return runDeferred(method, extendedEnv, unwrapReturnValue(evalFunctionBody(method.Body, extendedEnv)))
+	case *object.VariantType:
+		// calling a variant type, Status.Done(1), makes a variant of the arguments
+		args, err := bindKeywords(fn.Fields, args, keywords)
+		if err != nil {
+			return err
+		}
+		if len(args) != len(fn.Fields) {
+			return newError("wrong number of fields for %s: want=%d, got=%d",
+				fn.Inspect(), len(fn.Fields), len(args))
+		}
+		values := make([]object.Object, len(args))
+		copy(values, args)
+		return &object.Variant{VariantType: fn, Values: values}
+	case *object.StructType:
+		// calling a struct type makes a struct of the arguments, in field order
+		args, err := bindKeywords(fn.Fields, args, keywords)
+		if err != nil {
+			return err
+		}
+		if len(args) != len(fn.Fields) {
+			return newError("wrong number of fields for %s: want=%d, got=%d",
+				fn.Name, len(fn.Fields), len(args))
+		}
+		fields := make([]object.Object, len(args))
+		copy(fields, args)
+		return &object.Struct{StructType: fn, Fields: fields}
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object,
-) *object.Environment {
+func extendFunctionEnv(fn *object.Function, args []object.Object, keywords []string,
+) (*object.Environment, *object.Error) {
+	names := make([]string, len(fn.Parameters))
+	for i, param := range fn.Parameters {
+		names[i] = param.Value
+	}
+	args, err := bindKeywords(names, args, keywords)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != len(fn.Parameters) {
+		return nil, newError("wrong number of arguments: want=%d, got=%d",
+			len(fn.Parameters), len(args))
+	}
 	env := object.NewEnclosedEnvironment(fn.Env)
 	// initialize paramiters as environment values
 	for paramIdx, param := range fn.Parameters {
 		env.Set(param.Value, args[paramIdx])
 	}
-	return env
+	if fn.Defers {
+		env.Set("defer", &deferred{})
+	}
+	return env, nil
+}
+
+// args in the order of params, when some are keyword arguments
+func bindKeywords(params []string, args []object.Object, keywords []string) ([]object.Object, *object.Error) {
+	if keywords == nil {
+		return args, nil
+	}
+	bound, err := object.BindKeywords(params, args, keywords)
+	if err != nil {
+		return nil, newError("%s", err)
+	}
+	return bound, nil
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -355,8 +730,23 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ:
+		value, ok := left.(*object.Range).At(index.(*object.Integer).Value)
+		if !ok {
+			return NULL
+		}
+		return value
+	case index.Type() == object.RANGE_OBJ:
+		// xs[1..3] slices xs
+		selected, err := object.Select(left, index.(*object.Range))
+		if err != nil {
+			return newError("%s", err)
+		}
+		return selected
 	default:
 		// when use string literal to access the arry
 		return newError("index operator not supported: %s", left.Type())
@@ -366,19 +756,122 @@ func evalIndexExpression(left, index object.Object) object.Object {
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
 	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+	length := int64(len(arrayObject.Elements))
+	// negative index counts from the end, a[-1] is the last element
+	if idx < 0 {
+		idx += length
+	}
 	// index out of bound, return null
-	if idx < 0 || idx > max {
+	if idx < 0 || idx >= length {
 		return NULL
 	}
 	return arrayObject.Elements[idx]
 }
 
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	value := str.(*object.String).Value
+	idx := index.(*object.Integer).Value
+	length := int64(len(value))
+	if idx < 0 {
+		idx += length
+	}
+	if idx < 0 || idx >= length {
+		return NULL
+	}
+	return &object.String{Value: value[idx : idx+1]}
+}
+
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+	var length int
+	switch left := left.(type) {
+	case *object.Array:
+		length = len(left.Elements)
+	case *object.String:
+		length = len(left.Value)
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+	low, errObj := evalSliceBound(node.Start, env, 0, length)
+	if errObj != nil {
+		return errObj
+	}
+	high, errObj := evalSliceBound(node.End, env, length, length)
+	if errObj != nil {
+		return errObj
+	}
+	if high < low {
+		high = low
+	}
+	switch left := left.(type) {
+	case *object.Array:
+		// arrays are mutable, so the slice gets its own copy
+		elements := make([]object.Object, high-low)
+		copy(elements, left.Elements[low:high])
+		return &object.Array{Elements: elements}
+	default:
+		// strings are immutable, safe to share the underlying bytes
+		value := left.(*object.String).Value
+		return &object.String{Value: value[low:high]}
+	}
+}
+
+// resolve a slice bound python-style: omitted or null means the default,
+// negative counts from the end, and out of range bounds are clamped
+func evalSliceBound(node ast.Expression, env *object.Environment,
+	def int, length int,
+) (int, object.Object) {
+	if node == nil {
+		return def, nil
+	}
+	bound := Eval(node, env)
+	if isError(bound) {
+		return 0, bound
+	}
+	if bound == NULL {
+		return def, nil
+	}
+	integer, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, newError("slice index must be INTEGER, got %s", bound.Type())
+	}
+	idx := integer.Value
+	if idx < 0 {
+		idx += int64(length)
+	}
+	if idx < 0 {
+		return 0, nil
+	}
+	if idx > int64(length) {
+		return length, nil
+	}
+	return int(idx), nil
+}
+
 func evalHashLiteral(
 	node *ast.HashLiteral, env *object.Environment,
 ) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
-	for keyNode, valueNode := range node.Pairs {
+	// keys in source order, so later spreads and keys win
+	for _, keyNode := range node.Entries() {
+		if spread, ok := keyNode.(*ast.SpreadElement); ok {
+			evaluated := Eval(spread.Value, env)
+			if isError(evaluated) {
+				return evaluated
+			}
+			hash, ok := evaluated.(*object.Hash)
+			if !ok {
+				return newError("cannot spread %s, want HASH", evaluated.Type())
+			}
+			for k, pair := range hash.Pairs {
+				pairs[k] = pair
+			}
+			continue
+		}
+		valueNode := node.Pairs[keyNode]
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
@@ -398,6 +891,131 @@ func evalHashLiteral(
 	return &object.Hash{Pairs: pairs}
 }
 
+func evalRangeExpression(node *ast.RangeExpression, env *object.Environment) object.Object {
+	start := Eval(node.Start, env)
+	if isError(start) {
+		return start
+	}
+	end := Eval(node.End, env)
+	if isError(end) {
+		return end
+	}
+	var step object.Object
+	if node.Step != nil {
+		step = Eval(node.Step, env)
+		if isError(step) {
+			return step
+		}
+	}
+	r, err := object.NewRange(start, end, step, node.Inclusive)
+	if err != nil {
+		return newError("%s", err)
+	}
+	return r
+}
+
+// like an array literal, a spread takes anything iterable
+func evalSetLiteral(node *ast.SetLiteral, env *object.Environment) object.Object {
+	set := object.NewSet()
+	for _, el := range node.Elements {
+		if spread, ok := el.(*ast.SpreadElement); ok {
+			evaluated := Eval(spread.Value, env)
+			if isError(evaluated) {
+				return evaluated
+			}
+			iterator, errObj := iterate(evaluated)
+			if errObj != nil {
+				return newError("cannot spread %s, want an iterable", evaluated.Type())
+			}
+			for value, ok := iterator.NextValue(); ok; value, ok = iterator.NextValue() {
+				err := set.Add(value)
+				if err != nil {
+					return newError("%s", err)
+				}
+			}
+			err := iteratorError(iterator)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		evaluated := Eval(el, env)
+		if isError(evaluated) {
+			return evaluated
+		}
+		err := set.Add(evaluated)
+		if err != nil {
+			return newError("%s", err)
+		}
+	}
+	return set
+}
+
+// call collect for every element that passes the condition. each iteration
+// gets its own environment, so the loop variables don't leak and closures
+// capture the values of their own iteration. returns an error or nil
+func evalComprehension(
+	clause *ast.ComprehensionClause, env *object.Environment,
+	collect func(*object.Environment) object.Object,
+) object.Object {
+	iterable := Eval(clause.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+	iterator, errObj := iterate(iterable)
+	if errObj != nil {
+		return errObj
+	}
+
+	for {
+		loopEnv := object.NewEnclosedEnvironment(env)
+		if len(clause.Variables) == 1 {
+			value, ok := iterator.NextValue()
+			if !ok {
+				return iteratorError(iterator)
+			}
+			loopEnv.Set(clause.Variables[0].Value, value)
+		} else {
+			key, value, ok := iterator.Next()
+			if !ok {
+				return iteratorError(iterator)
+			}
+			loopEnv.Set(clause.Variables[0].Value, key)
+			loopEnv.Set(clause.Variables[1].Value, value)
+		}
+
+		if clause.Condition != nil {
+			condition := Eval(clause.Condition, loopEnv)
+			if isError(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				continue
+			}
+		}
+
+		err := collect(loopEnv)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// the body of a for loop runs in the environment of its iteration, like
+// a comprehension's element. a return or an error ends the loop
+func evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	return evalComprehension(&node.ComprehensionClause, env, func(loopEnv *object.Environment) object.Object {
+		result := Eval(node.Body, loopEnv)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+		return nil
+	})
+}
+
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 	key, ok := index.(object.Hashable)
@@ -410,3 +1028,185 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	}
 	return pair.Value
 }
+
+// the methods of a class close over an env that holds the superclass
+// as "super", a keyword so it can't clash with a user's name.
+// self is bound when a method is called
+func evalClassStatement(node *ast.ClassStatement, env *object.Environment) object.Object {
+	classEnv := object.NewEnclosedEnvironment(env)
+	class := &object.Class{Name: node.Name.Value, Methods: make(map[string]object.Object)}
+	if node.Super != nil {
+		super := evalIdentifier(node.Super, env)
+		if isError(super) {
+			return super
+		}
+		superClass, ok := super.(*object.Class)
+		if !ok {
+			return newError("superclass must be a class, got %s", super.Type())
+		}
+		class.Super = superClass
+		classEnv.Set("super", superClass)
+	} else {
+		classEnv.Set("super", NULL)
+	}
+	for _, m := range node.Methods {
+		class.Methods[m.Name.Value] = &object.Function{
+			Parameters: m.Function.Parameters,
+			Body:       m.Function.Body,
+			Env:        classEnv,
+			Generator:  m.Function.Generator,
+			Defers:     m.Function.Defers,
+		}
+	}
+	return class
+}
+
+// super.name, the superclass's method bound to self
+func evalSuperExpression(node *ast.SuperExpression, env *object.Environment) object.Object {
+	super, ok := env.Get("super")
+	if !ok {
+		return newError("super used outside of a class")
+	}
+	self, ok := env.Get("self")
+	if !ok {
+		return newError("super used outside of a class")
+	}
+	class, ok := super.(*object.Class)
+	if !ok {
+		return newError("super used in a class without a superclass")
+	}
+	method, ok := class.Lookup(node.Method.Value)
+	if !ok {
+		return newError("%s has no method %s", class.Name, node.Method.Value)
+	}
+	return &object.BoundMethod{Receiver: self.(*object.Instance), Method: method, Name: node.Method.Value}
+}
+
+// obj.field reads like obj["field"], but a missing field is an error
+func evalMemberExpression(left object.Object, name string) object.Object {
+	if module, ok := left.(*object.Module); ok {
+		value, ok := module.Exports[name]
+		if !ok {
+			return newError("%s is not exported by %s", name, module.Name)
+		}
+		return value
+	}
+	if task, ok := left.(*object.Task); ok {
+		if name != "await" {
+			return newError("task has no method %s", name)
+		}
+		return task.AwaitMethod()
+	}
+	if g, ok := left.(*object.Generator); ok {
+		switch name {
+		case "next":
+			return generatorNext(g)
+		case "close":
+			return generatorClose(g)
+		}
+		return newError("generator has no method %s", name)
+	}
+	if enum, ok := left.(*object.Enum); ok {
+		value, ok := enum.Member(name)
+		if !ok {
+			return newError("%s has no variant %s", enum.Name, name)
+		}
+		return value
+	}
+	if variant, ok := left.(*object.Variant); ok {
+		value, ok := variant.Get(name)
+		if !ok {
+			return newError("%s has no field %s", variant.VariantType.Inspect(), name)
+		}
+		return value
+	}
+	if instance, ok := left.(*object.Instance); ok {
+		value, ok := instance.Get(name)
+		if !ok {
+			return newError("%s has no field or method %s", instance.Class.Name, name)
+		}
+		return value
+	}
+	if s, ok := left.(*object.Struct); ok {
+		value, ok := s.Get(name)
+		if !ok {
+			return newError("%s has no field %s", s.StructType.Name, name)
+		}
+		return value
+	}
+	hashObject, ok := left.(*object.Hash)
+	if !ok {
+		return newError("cannot access field %s on %s", name, left.Type())
+	}
+	key := &object.String{Value: name}
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return newError("field not found: %s", name)
+	}
+	return pair.Value
+}
+
+// a[i] = v and obj.field = v, both update the collection in place
+// and evaluate to the assigned value
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	var left, index object.Object
+	switch target := node.Target.(type) {
+	case *ast.IndexExpression:
+		left = Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index = Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+	case *ast.MemberExpression:
+		left = Eval(target.Object, env)
+		if isError(left) {
+			return left
+		}
+		if left.Type() != object.HASH_OBJ && left.Type() != object.STRUCT_OBJ &&
+			left.Type() != object.INSTANCE_OBJ {
+			return newError("cannot assign field %s on %s", target.Member.Value, left.Type())
+		}
+		index = &object.String{Value: target.Member.Value}
+	default:
+		return newError("invalid assignment target: %s", node.Target)
+	}
+	value := Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+	switch left := left.(type) {
+	case *object.Array:
+		integer, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		idx := integer.Value
+		length := int64(len(left.Elements))
+		if idx < 0 {
+			idx += length
+		}
+		if idx < 0 || idx >= length {
+			return newError("index out of range: %d (array length %d)", integer.Value, length)
+		}
+		left.Elements[idx] = value
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+	case *object.Instance:
+		left.Fields[index.(*object.String).Value] = value
+	case *object.Struct:
+		name := index.(*object.String).Value
+		if !left.Set(name, value) {
+			return newError("%s has no field %s", left.StructType.Name, name)
+		}
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+	return value
+}
@@ -1,7 +1,11 @@
 package evaluator
 
 import (
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
 	"sawyer.com/v9/src/monkey/lexer"
 	"sawyer.com/v9/src/monkey/object"
@@ -226,6 +230,60 @@ func TestErrorHandling(t *testing.T) {
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			`{"name": "Monkey"}.age`,
+			"field not found: age",
+		},
+		{
+			`let x = 1; x.age`,
+			"cannot access field age on INTEGER",
+		},
+		{
+			`let a = [1, 2]; a[2] = 3`,
+			"index out of range: 2 (array length 2)",
+		},
+		{
+			`let h = {}; h[fn(x) { x }] = 1`,
+			"unusable as hash key: FUNCTION",
+		},
+		{
+			`let x = 1; x[0] = 1`,
+			"index assignment not supported: INTEGER",
+		},
+		{
+			`let x = 1; x.age = 1`,
+			"cannot assign field age on INTEGER",
+		},
+		{
+			"let x = 1; 2 |> x",
+			"pipeline stage x at 1:14: not a function: INTEGER",
+		},
+		{
+			`let bad = fn(x) { x - "a" };
+let run = fn(x) { x |> bad() };
+1 |> run()`,
+			"pipeline stage run at 3:3: pipeline stage bad at 2:21: type mismatch: INTEGER - STRING",
+		},
+		{
+			"[...1]",
+			"cannot spread INTEGER, want an iterable",
+		},
+		{
+			"len(...true)",
+			"cannot spread BOOLEAN, want an iterable",
+		},
+		{
+			"{...[1]}",
+			"cannot spread ARRAY, want HASH",
+		},
+		{
+			"const a = 1; let a = 2; a",
+			"cannot reassign const a",
+		},
+		{
+			"let f = fn() { const b = 1; const b = 2; b }; f()",
+			"cannot reassign const b",
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -339,6 +397,9 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("hello world")`, 11},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`let h = {"a": 1, "b": 2}; delete(h, "a")`, 1},
+		{`let h = {"a": 1, "b": 2}; delete(h, "a"); len([h["a"], h["b"]]) + h["b"]`, 4},
+		{`delete([], 1)`, "argument to `delete` must be HASH, got ARRAY"},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -419,6 +480,14 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 		{
 			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"[1, 2, 3][-3]",
+			1,
+		},
+		{
+			"[1, 2, 3][-4]",
 			nil,
 		},
 	}
@@ -508,3 +577,1120 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestMemberExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`{"port": 80}.port`, 80},
+		{`let config = {"server": {"port": 8080}}; config.server.port`, 8080},
+		{`let config = {"server": {"port": 8080}}; config.server["port"]`, 8080},
+		{`let m = {"double": fn(x) { x * 2 }}; m.double(21)`, 42},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3, 4][1:3]", []int64{2, 3}},
+		{"[1, 2, 3, 4][:2]", []int64{1, 2}},
+		{"[1, 2, 3, 4][2:]", []int64{3, 4}},
+		{"[1, 2, 3, 4][:]", []int64{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][-2:]", []int64{3, 4}},
+		{"[1, 2, 3, 4][:-1]", []int64{1, 2, 3}},
+		{"[1, 2, 3, 4][3:1]", []int64{}},
+		{"[1, 2, 3, 4][-10:10]", []int64{1, 2, 3, 4}},
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[-3:]`, "llo"},
+		{`"hello"[0]`, "h"},
+		{`"hello"[-1]`, "o"},
+		{`"hello"[5]`, nil},
+		{`let a = [1, 2, 3]; let b = a[1:]; len(push(b, 4)) + a[2]`, 6},
+		{`1[0:1]`, "slice operator not supported: INTEGER"},
+		{`[1, 2]["a":]`, "slice index must be INTEGER, got STRING"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d",
+					len(expected), len(array.Elements))
+				continue
+			}
+			for i, el := range expected {
+				testIntegerObject(t, array.Elements[i], el)
+			}
+		case string:
+			switch result := evaluated.(type) {
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("String has wrong value. got=%q, want=%q", result.Value, expected)
+				}
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, result.Message)
+				}
+			default:
+				t.Errorf("object is not String or Error. got=%T (%+v)", evaluated, evaluated)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = [1, 2, 3]; a[0] = 10; a[0]", 10},
+		{"let a = [1, 2, 3]; a[-1] = 10; a[2]", 10},
+		{"let a = [1, 2, 3]; a[1] = 5", 5},
+		{"let a = [1, 2, 3]; let b = a; b[0] = 7; a[0]", 7},
+		{"let a = [1, 2, 3]; let b = a[1:]; b[0] = 9; a[1]", 2},
+		{`let h = {}; h["x"] = 1; h["x"]`, 1},
+		{`let h = {"x": 1}; h["x"] = h["x"] + 1; h["x"]`, 2},
+		{`let h = {}; h.port = 80; h["port"]`, 80},
+		{`let c = {"server": {}}; c.server.port = 8080; c.server.port`, 8080},
+		{"let a = [0, 0]; let b = [0]; a[0] = b[0] = 3; a[0] + b[0]", 6},
+		{`let set = fn(h, k) { h[k] = len(k) }; let h = {}; set(h, "abc"); h["abc"]`, 3},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"const a = 5; a;", 5},
+		{"const a = 5; let f = fn() { let a = 10; a }; f() + a", 15},
+		{"const a = 5; let f = fn(a) { a }; f(1)", 1},
+		{"let a = 1; const a = 2; a", 2},
+		{`const config = {"port": 80}; config.port = 8080; config.port`, 8080},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestPipeExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let double = fn(x) { x * 2 }; 5 |> double", 10},
+		{"let add = fn(a, b) { a + b }; 5 |> add(1) |> add(10)", 16},
+		{"[1, 2, 3] |> push(4) |> len()", 4},
+		{"let sub = fn(a, b) { a - b }; 10 |> sub(3)", 7},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArrowFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let double = x => x * 2; double(21)", 42},
+		{"let add = (a, b) => a + b; add(1, 2)", 3},
+		{"let one = () => 1; one()", 1},
+		{"let f = (a) => { let b = a * 2; b + 1 }; f(3)", 7},
+		{"let adder = x => y => x + y; adder(1)(2)", 3},
+		{"let apply = fn(f, x) { f(x) }; apply(x => x - 1, 10)", 9},
+		{"let fact = n => if (n < 2) { 1 } else { n * fact(n - 1) }; fact(5)", 120},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; if (true) { let x = 2; x }", 2},
+		{"let x = 1; if (true) { let x = 2; }; x", 1},
+		{"let x = 1; if (false) { 0 } else { let x = x + 1; x }", 2},
+		{"let f = fn() { let a = 1; if (true) { let a = 10; let b = a } else { 0 }; a }; f()", 1},
+		{"let f = fn(n) { if (n > 0) { let a = n; a * 2 } else { let b = 7; b } }; f(3) + f(0)", 13},
+		{"let g = if (true) { let a = 4; fn() { a } } else { 0 }; let b = 5; g() + b", 9},
+		{"if (true) { if (true) { let a = 1; let b = 2; a + b } }", 3},
+		{"const c = 1; if (true) { let c = 2; c }", 2},
+		{`let h = {"x": 1, "f": fn() { h["x"] }}; h["f"]()`, 1},
+		{`let g = fn() { let h = {"x": 1, "f": fn() { h["x"] }}; h["f"]() }; g()`, 1},
+		{`let g = fn() { if (true) { let h = [2, fn() { h[0] }]; h[1]() } }; g()`, 2},
+		{"let x = 3; let x = [x for y in [1]]; x[0]", 3},
+		{"let x = 2; let f = fn() { let x = [x * y for y in [1, 2]]; x[1] }; f()", 4},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testNullObject(t, testEval("if (true) { let a = 1; }"))
+	testNullObject(t, testEval("if (false) { 1 } else { }"))
+
+	evaluated := testEval("if (true) { let a = 1; }; a")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "identifier not found: a" {
+		t.Errorf("expected a not to be visible outside its block, got=%+v", evaluated)
+	}
+}
+
+var testModules = map[string]string{
+	"lib/strings.monkey": `
+let prefix = "> ";
+export let shout = fn(s) { prefix + s + "!" };
+export const version = 2;
+export let adder = fn(n) { fn(x) { x + n + version } };
+export let apply = fn(f, x) { f(x) };
+`,
+	"counter.monkey": `export let state = {"n": 0};`,
+	"a.monkey":       `import "counter.monkey" as c; export let counter = c;`,
+	"b.monkey":       `import "counter.monkey" as c; export let counter = c;`,
+	"cycle/x.monkey": `import "y.monkey" as y;`,
+	"cycle/y.monkey": `import "x.monkey" as x;`,
+	"fails.monkey":   `let boom = fn(x) { x + true }; boom(1);`,
+	"evals.monkey":   `let secret = 2; export let peek = fn(name) { eval(name) };`,
+}
+
+// point Modules at a directory with the files, restored when the test ends
+func useModules(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, source := range files {
+		file := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(file), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(file, []byte(source), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := Modules
+	Modules = NewLoader([]string{dir})
+	t.Cleanup(func() { Modules = saved })
+}
+
+func TestModules(t *testing.T) {
+	useModules(t, testModules)
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// the module's environment isn't the importer's
+		{`let prefix = "?"; import "lib/strings.monkey" as s; s.shout("hi")`, "> hi!"},
+		{`import "lib/strings.monkey" as s; s.version`, 2},
+		{`import "lib/strings.monkey" as s; let add = s.adder(10); add(1)`, 13},
+		{`let k = 5; import "lib/strings.monkey" as s; s.apply(fn(x) { x + k }, 1)`, 6},
+		{`let f = fn() { import "lib/strings.monkey" as s; s.version }; f()`, 2},
+		// a module runs once, importers share it
+		{`import "a.monkey" as a; import "b.monkey" as b; a.counter.state.n = 7; b.counter.state.n`, 7},
+		// eval in a module sees the module's globals
+		{`import "evals.monkey" as e; e.peek("secret")`, 2},
+		{`let secret = 1; import "evals.monkey" as e; e.peek("secret")`, 2},
+		{`import "lib/strings.monkey" as s; s.prefix`, "ERROR: prefix is not exported by lib/strings.monkey"},
+		{`import "missing.monkey" as m;`, "ERROR: module not found: missing.monkey"},
+		{`import "cycle/x.monkey" as x;`,
+			"ERROR: module cycle/x.monkey: module y.monkey: import cycle: cycle/x.monkey -> y.monkey -> x.monkey"},
+		{`import "fails.monkey" as f;`, "ERROR: module fails.monkey: type mismatch: INTEGER + BOOLEAN"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if "ERROR: "+errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+				}
+				continue
+			}
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("expected %q, got=%+v", expected, evaluated)
+			}
+		}
+	}
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { throw 1 } catch (e) { e + 1 }", 2},
+		{"try { 5 } catch (e) { 0 }", 5},
+		{`let f = fn() { throw "x" }; try { f() } catch (e) { e }`, "x"},
+		{"let g = fn(n) { if (n == 0) { throw 42 } else { g(n - 1) } }; try { g(10) } catch (e) { e }", 42},
+		{"1 + try { throw 1 } catch (e) { 10 }", 11},
+		{"len(try { len(1) } catch (e) { [1, 2] })", 2},
+		{`let h = {"n": 0}; try { 1 } finally { h.n = 5 }; h.n`, 5},
+		{"try { 1 } finally { 2 }", 1},
+		{`let h = {"n": 0}; try { try { throw 1 } finally { h.n = h.n + 1 } } catch (e) { e + h.n }`, 2},
+		{`let h = {"n": 0}; let f = fn() { try { return 1 } finally { h.n = 7 } }; f() + h.n`, 8},
+		{`let h = {"n": 0}; let f = fn() { try { throw 1 } catch (e) { return e + 1 } finally { h.n = 10 } }; f() + h.n`, 12},
+		{"try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e * 10 }", 20},
+		{"let f = fn() { try { return 1 } catch (e) { 100 } }; f(); try { throw 5 } catch (e) { e }", 5},
+		{"try { throw 1 } catch { 9 }", 9},
+		{"try { throw 1 } catch (e) { let x = e * 3; x }", 3},
+		{"let f = fn(x) { throw x }; try { 1 |> f } catch (e) { e }", 1},
+		{"let f = fn(a) { a }; try { f(1, 2) } catch (e) { e.message }", "wrong number of arguments: want=1, got=2"},
+		{"try { len(1) } catch (e) { e.message }", "argument to `len` not supported, got INTEGER"},
+		{"try { 1 + true } catch (e) { e.message }", "type mismatch: INTEGER + BOOLEAN"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("expected %q, got=%+v", expected, evaluated)
+			}
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"throw 1", "uncaught exception: 1"},
+		{`try { throw "a" } finally { 1 }`, "uncaught exception: a"},
+		{"try { throw 1 } catch (e) { throw e + 1 }", "uncaught exception: 2"},
+		{"let f = fn() { throw 1 }; let g = fn() { f() }; g()", "uncaught exception: 1"},
+	}
+	for _, tt := range errors {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	point := "struct Point { x, y } "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{point + "let p = Point(1, 2); p.x + p.y", 3},
+		{point + "let p = Point(1, 2); p.x = 5; p.x * p.y", 10},
+		{point + "let f = fn(p) { p.y = 3; p.y }; f(Point(7, 8))", 3},
+		{point + `Point(1, "a") == Point(1, "a")`, true},
+		{point + "Point(1, 2) == Point(2, 1)", false},
+		{point + "Point(1, 2) != Point(1, 3)", true},
+		{point + "struct Line { a, b } Line(Point(0, 0), Point(1, 1)) == Line(Point(0, 0), Point(1, 1))", true},
+		{point + "struct Other { x, y } Point(1, 2) == Other(1, 2)", false},
+		{point + "let mk = fn(x) { struct Point { x, y } Point(x, 0) }; mk(1) == mk(1)", true},
+		{point + "let p = Point(1, 2); let f = fn() { p.z = p.w }; 5", 5},
+		{point + "let f = fn() { Point(1) }; 5", 5},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{point + "let p = Point(1, 2); p.z", "Point has no field z"},
+		{point + "let p = Point(1, 2); p.z = 1", "Point has no field z"},
+		{point + "Point(1)", "wrong number of fields for Point: want=2, got=1"},
+		{"const Point = 1; struct Point { x }", "cannot reassign const Point"},
+	}
+	for _, tt := range errors {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestClasses(t *testing.T) {
+	counter := `class Counter {
+		init(start) { self.count = start }
+		inc() { self.count = self.count + 1; self }
+		get() { self.count }
+	} `
+	animals := `class Animal {
+		init(name) { self.name = name }
+		speak() { "..." }
+		describe() { self.name + " says " + self.speak() }
+	}
+	class Dog extends Animal {
+		init(name) { super.init(name); self.tricks = 0 }
+		speak() { "woof" }
+		parent() { super.speak() }
+	} `
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{counter + "let c = Counter(5); c.inc(); c.inc(); c.get()", 7},
+		{counter + "Counter(1).inc().inc().count", 3},
+		{counter + "let c = Counter(0); let inc = c.inc; inc(); inc(); c.count", 2},
+		{counter + "let a = Counter(0); let b = Counter(10); a.inc(); b.get() - a.get()", 9},
+		{counter + "let c = Counter(0); let a = [c.inc().count for x in [1, 2, 3]]; a[0] + a[2]", 4},
+		{counter + "let c = Counter(0); c.extra = 4; c.extra", 4},
+		{animals + `Dog("rex").describe()`, "rex says woof"},
+		{animals + `Animal("cat").describe()`, "cat says ..."},
+		{animals + `Dog("rex").parent()`, "..."},
+		{animals + `Dog("rex").tricks`, 0},
+		{"class Empty {} let e = Empty(); e.x = 1; e.x", 1},
+		{"class A { init() { self.x = 1; return 5 } } A().x", 1},
+		{"class A { f() { fn() { self.x } } } let a = A(); a.x = 3; a.f()()", 3},
+		{"class A { f(g) { self.y * g } } let a = A(); a.y = 2; [1, 2] |> len |> a.f()", 4},
+		{"let make = fn() { class Inner { v() { 1 } } Inner }; make()().v()", 1},
+		// a method can name its own class, here and in a closure it makes
+		{"class C { init() { self.n = 1 } clone() { let c = C(); c.n = self.n + 1; c } } C().clone().clone().n", 3},
+		{"let make = fn() { class Node { init() { self.k = 7 } child() { Node() } } Node }; make()().child().k", 7},
+		{"class C { init() { self.n = 2 } f() { fn() { C().n } } } C().f()()", 2},
+		{counter + "try { Counter() } catch (e) { e.message }", "wrong number of arguments: want=1, got=0"},
+		{counter + "try { Counter(1).missing } catch (e) { e.message }", "Counter has no field or method missing"},
+		{counter + "try { Counter(1).inc(2) } catch (e) { e.message }", "wrong number of arguments: want=0, got=1"},
+		{"class A {} try { A(1) } catch (e) { e.message }", "wrong number of arguments: want=0, got=1"},
+		{"class A { f() { super.f() } } try { A().f() } catch (e) { e.message }",
+			"super used in a class without a superclass"},
+		{"class A {} class B extends A { f() { super.g() } } try { B().f() } catch (e) { e.message }",
+			"A has no method g"},
+		{"let A = 1; try { class B extends A {} } catch (e) { e.message }", "superclass must be a class, got INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("expected %q for %q, got=%+v", expected, tt.input, evaluated)
+			}
+		}
+	}
+}
+
+func TestEnums(t *testing.T) {
+	status := "enum Status { Pending, Done(result), Failed(code, reason) } "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{status + "Status.Pending == Status.Pending", true},
+		{status + "Status.Pending == Status.Done(1)", false},
+		{status + "Status.Done(1) == Status.Done(1)", true},
+		{status + `Status.Done("a") != Status.Done("b")`, true},
+		{status + "Status.Done(1) == Status.Failed(1, 2)", false},
+		{status + "Status.Done(Status.Pending) == Status.Done(Status.Pending)", true},
+		{status + "enum Other { Pending } Status.Pending == Other.Pending", false},
+		{status + `Status.Failed(2, "disk full").reason`, "disk full"},
+		{status + "let done = Status.Done; done(5).result", 5},
+		{status + `let h = {Status.Pending: "waiting", Status.Done(1): "one"}; h[Status.Pending] + h[Status.Done(1)]`, "waitingone"},
+		{status + "let f = fn(s) { if (s == Status.Pending) { 0 } else { s.result } }; f(Status.Pending) + f(Status.Done(3))", 3},
+		{status + "let f = fn(e) { e.Pendng }; try { f(Status) } catch (e) { e.message }", "Status has no variant Pendng"},
+		{status + "try { Status.Pendng } catch (e) { e.message }", "Status has no variant Pendng"},
+		{status + "let f = fn() { Status.Pendng }; 5", 5},
+		{status + "try { Status.Done(1).reason } catch (e) { e.message }", "Status.Done has no field reason"},
+		{status + "try { Status.Done(1, 2) } catch (e) { e.message }", "wrong number of fields for Status.Done: want=1, got=2"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("expected %q for %q, got=%+v", expected, tt.input, evaluated)
+			}
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// far deeper than MaxFrames
+		{"let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(100000, 0)", 5000050000},
+		{`let count = fn(n) { if (n == 0) { return "done" }; return count(n - 1) }; count(50000)`, "done"},
+		{"let fns = {}; let even = fn(n) { if (n == 0) { true } else { fns.odd(n - 1) } }; fns.odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(10001)", false},
+		{"let make = fn(step) { let loop = fn(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + step) } }; loop }; make(2)(3000, 0)", 6000},
+		{"class Counter { count(n, acc) { if (n == 0) { acc } else { self.count(n - 1, acc + 1) } } } Counter().count(5000, 0)", 5000},
+		// init still makes its instance
+		{"class A { init(x) { self.set(x) } set(x) { self.x = x } } A(5).x", 5},
+		{"let f = fn(xs) { len(xs) }; f([1, 2, 3])", 3},
+		{"struct P { x } let mk = fn(x) { P(x) }; mk(4).x", 4},
+		{"let gen = fn() { yield 1 }; let f = fn() { gen() }; f().next().value", 1},
+		// a call inside a try is caught by it
+		{"let f = fn() { throw 1 }; let g = fn() { try { return f() } catch (e) { e + 1 } }; g()", 2},
+		{"let f = fn(a) { a }; let g = fn() { f() }; try { g() } catch (e) { e.message }", "wrong number of arguments: want=1, got=0"},
+		{"class A { f(a) { a } g() { self.f() } } try { A().g() } catch (e) { e.message }", "wrong number of arguments: want=1, got=0"},
+		// with keyword arguments too
+		{"let f = fn(n, k) { if (n == 0) { k } else { f(n - 1, k: k + 1) } }; f(100000, 0)", 100000},
+		{"class C { count(n, acc) { if (n == 0) { acc } else { self.count(acc: acc + 1, n: n - 1) } } } C().count(5000, 0)", 5000},
+		{"let f = fn(a) { a }; let g = fn() { f(b: 1) }; try { g() } catch (e) { e.message }", "unexpected keyword argument b"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("expected %q for %q, got=%+v", expected, tt.input, evaluated)
+			}
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	// an infinite stream, by delegating to the rest of it
+	nat := "let nat = fn(i) { yield i; yield* nat(i + 1) }; "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let g = fn() { yield 1; yield 2 }; let it = g(); it.next().value + it.next().value", 3},
+		{"let g = fn() { yield 1; 5 }; let it = g(); it.next(); let last = it.next(); if (last.done) { last.value } else { 0 }", 5},
+		{"let g = fn() { yield 1 }; let it = g(); it.next(); it.next(); it.next().done", true},
+		{"let g = fn() { yield 1 }; let it = g(); it.next().done", false},
+		{"let g = fn(a, b) { yield a; yield b }; let it = g(3, 4); it.next(); it.next().value", 4},
+		// a yield evaluates to what the next next() sends
+		{"let g = fn() { let x = yield 1; yield x * 10 }; let it = g(); it.next(); it.next(4).value", 40},
+		// nothing runs before the first next()
+		{`let h = {"n": 0}; let g = fn() { h.n = 1; yield 1 }; let it = g(); h.n`, 0},
+		// generators are independent of each other
+		{"let g = fn() { let x = 0; yield x; yield x + 1 }; let a = g(); let b = g(); a.next(); a.next().value + b.next().value", 1},
+		// the paused frame keeps its locals and its part of the stack
+		{"let g = fn() { let a = 1; let b = 2; yield a; yield a + b }; let it = g(); it.next(); it.next().value", 3},
+		{"let g = fn() { [1, 2, yield 3] }; let it = g(); it.next(); len(it.next(9).value)", 3},
+		{"let g = fn() { let inner = fn() { 7 }; yield inner(); yield inner() + 1 }; let it = g(); it.next().value + it.next().value", 15},
+		{"let xs = fn() { let x = 0; let f = fn() { x }; yield f(); }; xs().next().value", 0},
+		{"let g = fn() { throw 7; yield 1 }; try { g().next() } catch (e) { e }", 7},
+		{"let g = fn() { yield 1 + true }; try { g().next() } catch (e) { e.message }",
+			"type mismatch: INTEGER + BOOLEAN"},
+		{"let g = fn() { throw 1; yield 2 }; let it = g(); try { it.next() } catch (e) { 0 }; it.next().done", true},
+		{`let h = {}; let g = fn() { yield h.it.next() }; h.it = g(); try { h.it.next() } catch (e) { e.message }`,
+			"generator is already running"},
+		{"class Box { init(v) { self.v = v } items() { yield self.v; yield self.v * 2 } } let it = Box(5).items(); it.next(); it.next().value", 10},
+		{nat + "let it = nat(0); it.next(); it.next(); it.next().value", 2},
+		{nat + "let it = nat(5); let xs = [it.next().value for x in [1, 2, 3, 4]]; xs[0] + xs[3]", 13},
+		{"let inner = fn() { yield 1; 10 }; let outer = fn() { let r = yield* inner(); yield r }; let it = outer(); it.next(); it.next().value", 10},
+		{"let g = fn() { yield* 1 }; try { g().next() } catch (e) { e.message }", "cannot access field next on INTEGER"},
+		{"let g = fn() { yield 1 }; try { g().prev() } catch (e) { e.message }", "generator has no method prev"},
+		{"let g = fn() { yield 1; yield 2 }; let it = g(); it.next(); it.close(); it.next().done", true},
+		{"let g = fn() { yield 1 }; let it = g(); it.close(); it.next().done", true},
+		{`let h = {"n": 0}; let g = fn() { yield 1; h.n = 1; yield 2 }; let it = g(); it.next(); it.close(); it.next(); h.n`, 0},
+		{`let h = {}; let g = fn() { yield h.it.close() }; h.it = g(); try { h.it.next() } catch (e) { e.message }`,
+			"generator is already running"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("expected %q for %q, got=%+v", expected, tt.input, evaluated)
+			}
+		}
+	}
+
+	errObj, ok := testEval("let g = fn() { throw 7; yield 1 }; g().next()").(*object.Error)
+	if !ok || errObj.Message != "uncaught exception: 7" {
+		t.Errorf("expected an uncaught exception, got=%+v", errObj)
+	}
+}
+
+func TestAbandonedGenerators(t *testing.T) {
+	nat := "let nat = fn(i) { yield i; yield* nat(i + 1) }; "
+	tests := []string{
+		// closed, a goroutine for every generator the delegation started
+		nat + "let it = nat(0); it.next(); it.next(); it.next(); it.close()",
+		// dropped unfinished, it's closed when it's collected
+		nat + "let f = fn() { let it = nat(0); it.next(); it.next(); it.next() }; f()",
+	}
+	for _, input := range tests {
+		before := runtime.NumGoroutine()
+		testEval(input)
+		deadline := time.Now().Add(5 * time.Second)
+		for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+			runtime.GC()
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := runtime.NumGoroutine(); n > before {
+			t.Errorf("%d goroutines left running for %q", n-before, input)
+		}
+	}
+}
+
+func TestTasks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let ch = channel(1); send(ch, 5); recv(ch)", 5},
+		{"let ch = channel(2); send(ch, 1); send(ch, 2); recv(ch) * 10 + recv(ch)", 12},
+		{"let t = spawn(fn() { 1 + 2 }); t.await()", 3},
+		{"let t = spawn(fn(a, b) { a * b }, 6, 7); t.await()", 42},
+		// awaiting again gives the same result
+		{"let t = spawn(fn() { 4 }); t.await() + t.await()", 8},
+		// an unbuffered channel hands a value from one task to another
+		{"let ch = channel(); spawn(fn() { send(ch, 9) }); recv(ch)", 9},
+		// fan-in, every producer sends to the same channel
+		{"let ch = channel(); let produce = fn(n) { send(ch, n) }; spawn(produce, 1); spawn(produce, 2); spawn(produce, 3); recv(ch) + recv(ch) + recv(ch)", 6},
+		// a task reads the globals defined before it was spawned
+		{"let base = 100; let t = spawn(fn(x) { base + x }, 5); t.await()", 105},
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; let a = spawn(fib, 15); let b = spawn(fib, 16); a.await() + b.await()", 1597},
+		{"let worker = fn(input, output) { send(output, recv(input) * 2) }; let input = channel(); let output = channel(); spawn(worker, input, output); send(input, 21); recv(output)", 42},
+		{"class Counter { init(n) { self.n = n } get() { self.n } } let c = Counter(3); spawn(c.get).await()", 3},
+		// what a task throws is thrown again by await
+		{"let t = spawn(fn() { throw 7 }); try { t.await() } catch (e) { e }", 7},
+		{"let ch = channel(1); close(ch); recv(ch)", nil},
+		{"let ch = channel(1); send(ch, 1); close(ch); recv(ch)", 1},
+		{"let ch = channel(); close(ch); try { send(ch, 1) } catch (e) { e.message }", "send on closed channel"},
+		{"let ch = channel(); close(ch); try { close(ch) } catch (e) { e.message }", "close of closed channel"},
+		{"try { spawn(1) } catch (e) { e.message }", "argument to `spawn` must be a function, got INTEGER"},
+		{"try { channel(-1) } catch (e) { e.message }", "argument to `channel` must be a non-negative INTEGER, got -1"},
+		{"try { recv(1) } catch (e) { e.message }", "argument to `recv` must be CHANNEL, got INTEGER"},
+		{"try { spawn(fn() { 1 }).cancel() } catch (e) { e.message }", "task has no method cancel"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("expected %q for %q, got=%+v", expected, tt.input, evaluated)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	errObj, ok := testEval("spawn(fn() { 1 + true }).await()").(*object.Error)
+	if !ok || errObj.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("expected the task's error, got=%+v", errObj)
+	}
+}
+
+func TestComprehensions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = [x * 2 for x in [1, 2, 3]]; a[0] + a[1] + a[2] + len(a)", 15},
+		{"len([x for x in [3, -1, 0, 5] if x > 0])", 2},
+		{"len([x for x in []])", 0},
+		{"[i * v for i, v in [5, 6, 7]][2]", 14},
+		{`len([c for i, c in "abc" if i > 0])`, 2},
+		{"[k for k in {3: 1, 1: 2, 2: 3}][0]", 1},
+		{"[v for k, v in {3: 1, 1: 2, 2: 3}][2]", 1},
+		{"let f = fn(xs, m) { [x * m for x in xs] }; f([1, 2], 3)[1]", 6},
+		{"let x = 5; [x for x in [1]]; x", 5},
+		{"let x = [1, 2]; [x * 2 for x in x][1]", 4},
+		{"let fs = [fn() { x } for x in [1, 2]]; fs[0]() + fs[1]() * 10", 21},
+		{"let h = {x: x * x for x in [1, 2, 3] if x != 2}; h[1] + h[3] + len([k for k in h])", 12},
+		{`let h = {"a": 1, "b": 2}; let g = {k: v + 1 for k, v in h}; g["a"] + g["b"]`, 5},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"[x for x in 1]", "cannot iterate over INTEGER"},
+		{"{x: 1 for x in [[1]]}", "unusable as hash key: ARRAY"},
+		{"[x for x in [1]]; x", "identifier not found: x"},
+	}
+	for _, tt := range errors {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestSpreadElements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = [1, 2]; let b = [4]; let c = [...a, 3, ...b]; c[0] + c[2] * c[3] + len(c)", 17},
+		{"len([...[], ...[]])", 0},
+		{"let a = [1, 2]; let b = [...a]; b[0] = 9; a[0]", 1},
+		{"let add = fn(a, b, c) { a + b + c }; let args = [1, 2, 3]; add(...args)", 6},
+		{"let add = fn(a, b, c) { a + b + c }; add(1, ...[2, 3])", 6},
+		{"let f = fn(a, b) { a - b }; 10 |> f(...[4])", 6},
+		{`let d = {"a": 1, "b": 2}; let h = {...d, "b": 3}; h["a"] + h["b"]`, 4},
+		{`let d = {"a": 1, "b": 2}; let h = {"b": 3, ...d}; h["b"]`, 2},
+		{`let d = {"a": 1}; let o = {"a": 5}; {...d, ...o}.a`, 5},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestKeywordArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let connect = fn(host, port, tls) { [host, port, tls] }; connect("h", port: 80, tls: true)[1]`, 80},
+		{"let sub = fn(a, b) { a - b }; sub(b: 1, a: 10)", 9},
+		{"let sub = fn(a, b) { a - b }; let f = fn() { sub(b: 2, a: 3) }; f()", 1},
+		{"let sub = fn(a, b) { a - b }; 10 |> sub(b: 4)", 6},
+		{"class Box { init(w, h) { self.area = w * h } scale(by, plus) { self.area * by + plus } } Box(h: 2, w: 3).scale(plus: 1, by: 2)", 13},
+		{"struct Point { x, y } let p = Point(y: 2, x: 1); p.x * 10 + p.y", 12},
+		{"enum Shape { Rect(w, h) } let r = Shape.Rect(h: 3, w: 2); r.w * 10 + r.h", 23},
+		{"let gen = fn(from, to) { yield from; yield to }; gen(to: 2, from: 1).next().value", 1},
+		// spread arguments come before the keyword arguments
+		{"let f = fn(a, b) { a * 10 + b }; f(...[1], b: 2)", 12},
+		{"struct P { x, y } let p = P(...[1], y: 2); p.x * 10 + p.y", 12},
+		{`let h = {"t": 0}; let rec = fn(a, b) { h.t = a * 10 + b }; let f = fn() { defer rec(...[1], b: 2); 0 }; f(); h.t`, 12},
+		{"struct Point { x, y } let f = fn() { Point(x: 1, z: 2) }; 5", 5},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn(a) { a }; f(b: 1)", "unexpected keyword argument b"},
+		{"struct Point { x, y } Point(x: 1, z: 2)", "unexpected keyword argument z"},
+		{"let f = fn(a, b) { a }; f(1, a: 2)", "duplicate argument a"},
+		{"let f = fn(a, b) { a }; f(b: 1)", "missing argument a"},
+		// the names are checked before the count
+		{"let f = fn(a) { a }; f(1, a: 2)", "duplicate argument a"},
+		{"let f = fn(a, b) { a }; f(1, b: 2, b: 3)", "duplicate argument b"},
+		{"let f = fn(a, b) { a }; f(a: 1, b: 2, c: 3)", "unexpected keyword argument c"},
+		{"let f = fn(a, b) { a }; f(...[1, 2], b: 3)", "duplicate argument b"},
+		{"class A { f(a) { a } } A().f(self: 1)", "unexpected keyword argument self"},
+		{"len(x: [1])", "builtin functions take no keyword arguments"},
+	}
+	for _, tt := range errors {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestDefer(t *testing.T) {
+	log := `let log = {"s": ""}; let add = fn(x) { log["s"] = log["s"] + x }; `
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{log + `let f = fn() { defer add("a"); defer add("b"); add("c"); 1 }; f() + len(log["s"])`, 4},
+		{log + `let f = fn() { defer add("a"); defer add("b"); add("c") }; f(); log["s"]`, "cba"},
+		// the callee and arguments are evaluated by the defer statement
+		{log + `let f = fn(n) { defer add(x: n); if (len(n) > 0) { return n }; add("x"); 0 }; f("1"); log["s"]`, "1"},
+		{log + `let f = fn() { let g = fn(a, b) { add(a + b) }; defer g(...["s", "t"]); 1 }; f(); log["s"]`, "st"},
+		{log + `let f = fn() { defer add("d"); throw "boom" }; try { f() } catch (e) { e + log["s"] }`, "boomd"},
+		{log + `let inner = fn() { defer add("i"); throw 1 }; let outer = fn() { defer add("o"); inner() }; try { outer() } catch (e) { log["s"] }`, "io"},
+		{log + `let f = fn() { defer add("d"); 1 + true }; try { f() } catch (e) { log["s"] }`, "d"},
+		// a throw from a deferred call replaces the result, the rest still run
+		{log + `let f = fn() { defer add("a"); defer fn() { throw "late" }(); 1 }; try { f() } catch (e) { e + log["s"] }`, "latea"},
+		{log + `let f = fn() { defer fn() { throw "late" }(); throw "early" }; try { f() } catch (e) { e }`, "late"},
+		// the call in tail position runs before the deferred ones
+		{log + `let g = fn() { add("g") }; let f = fn() { defer add("f"); g() }; f(); log["s"]`, "gf"},
+		{log + `class A { init() { defer add("i"); self.x = 1 } get() { defer add("g"); self.x } } A().get() + len(log["s"])`, 3},
+		{log + `let g = fn() { defer add("end"); yield 1 }; let it = g(); it.next(); it.next(); log["s"]`, "end"},
+		{log + `let f = fn() { if (true) { defer add("b") }; add("a") }; f(); log["s"]`, "ab"},
+		// a function without defer statements doesn't run its caller's
+		{log + `let f = fn() { defer add("f"); let g = fn() { add("g") }; g(); add("-") }; f(); log["s"]`, "g-f"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("expected %q, got=%+v", expected, evaluated)
+			}
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`eval("1 + 2")`, 3},
+		{`let x = 10; eval("x * 2")`, 20},
+		{`eval("a + b", {"a": 1, "b": 2})`, 3},
+		{`let f = fn(n) { eval("n + 1", {"n": n}) }; f(4)`, 5},
+		{`eval("let y = 5; y * y")`, 25},
+		{`eval("return 7; 8")`, 7},
+		// its lets stay in its own environment
+		{`let y = 1; eval("let y = 2; y") * 10 + y`, 21},
+		{`let double = eval("fn(x) { x * 2 }"); double(21)`, 42},
+		{`let rules = ["x > 1", "x > 5"]; let h = {"x": 3}; len([r for r in rules if eval(r, h)])`, 1},
+		{`let log = {"s": ""}; let v = "set"; eval("log.s = v"); log.s`, "set"},
+		// a global defined after the call isn't there yet
+		{`let r = try { eval("later + 1") } catch (e) { e.message }; let later = 1; r`, "identifier not found: later"},
+		{`let f = fn() { eval("later") }; let later = 3; f()`, 3},
+		{`try { eval("let = 1") } catch (e) { e.message }`, "eval: expected next token to be IDENT, got = instead; no prefix parse function for = found"},
+		{`try { eval("z + 1") } catch (e) { e.message }`, "identifier not found: z"},
+		{`try { eval("throw 5") } catch (e) { e }`, 5},
+		{`try { eval(1) } catch (e) { e.message }`, "argument to `eval` must be STRING, got INTEGER"},
+		{`spawn(eval, "1 + 1").await()`, 2},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("expected %q, got=%+v", expected, evaluated)
+			}
+		}
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"9223372036854775807 + 1 == 9223372036854775808", true},
+		{"let fib = fn(n, a, b) { if (n == 0) { a } else { fib(n - 1, b, a + b) } }; fib(100, 0, 1) == 354224848179261915075", true},
+		{"let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(25) == 15511210043330985984000000", true},
+		{"-9223372036854775807 - 2 == -9223372036854775809", true},
+		{"-9223372036854775808 == -9223372036854775807 - 1", true},
+		{"3037000500 * 3037000500 == 9223372037000250000", true},
+		{"100000000000000000000 / 10 == 10000000000000000000", true},
+		{"100000000000000000000 > 9223372036854775807", true},
+		{"-100000000000000000000 < 1", true},
+		{"(9223372036854775807 + 10) - 20", 9223372036854775797},
+		{"let h = {9223372036854775807: 1}; h[(9223372036854775807 + 1) - 1]", 1},
+		{"let h = {100000000000000000000: 2}; h[99999999999999999999 + 1]", 2},
+		{"struct Big { n } Big(99999999999999999999 + 1) == Big(100000000000000000000)", true},
+		{"try { 1 / 0 } catch (e) { e.message }", "division by zero"},
+		{"try { 100000000000000000000 + true } catch (e) { e.message }", "type mismatch: BIGINT + BOOLEAN"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("expected %q, got=%+v", expected, evaluated)
+			}
+		}
+	}
+
+	evaluated := testEval("99999999999999999999 * 10")
+	big, ok := evaluated.(*object.BigInt)
+	if !ok || big.Inspect() != "999999999999999999990" {
+		t.Errorf("expected a big integer, got=%+v", evaluated)
+	}
+}
+
+func TestSets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"len(#{1, 2, 2, 3})", 3},
+		{"len(#{})", 0},
+		{"2 in #{1, 2}", true},
+		{"5 in #{1, 2}", false},
+		{"1 + 1 in #{2}", true},
+		{"\"b\" in #{\"a\", \"b\"}", true},
+		{"9223372036854775807 + 1 - 1 in #{9223372036854775807}", true},
+		{"#{1, 2} == #{2, 1}", true},
+		{"#{1} != #{1, 2}", true},
+		{"len(#{...[1, 1, 2], ...[2, 3]})", 3},
+		{"len(#{x > 2 for x in [1, 2, 3, 4]})", 2},
+		{"[x for x in #{3, 1, 2, 1}]", []int{1, 2, 3}},
+		{"union(#{1, 2}, #{2, 3}) == #{1, 2, 3}", true},
+		{"intersection(#{1, 2}, #{2, 3}) == #{2}", true},
+		{"difference(#{1, 2}, #{2, 3}) == #{1}", true},
+		{"2 in [1, 2]", true},
+		{"\"a\" in {\"a\": 1}", true},
+		{"\"ok\" in \"monkey\"", false},
+		{"\"key\" in \"monkey\"", true},
+		{"try { #{[1]} } catch (e) { e.message }", "unusable as set element: ARRAY"},
+		{"try { 1 in 2 } catch (e) { e.message }", "operator in not supported: INTEGER in INTEGER"},
+		{"try { union(#{1}, 1) } catch (e) { e.message }", "arguments to `union` must be SET, got INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%s: expected %q, got=%+v", tt.input, expected, evaluated)
+			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok || len(array.Elements) != len(expected) {
+				t.Errorf("%s: expected %v, got=%+v", tt.input, expected, evaluated)
+				continue
+			}
+			for i, el := range expected {
+				testIntegerObject(t, array.Elements[i], int64(el))
+			}
+		}
+	}
+
+	evaluated := testEval("#{3, \"a\", 1, true}")
+	if evaluated.Inspect() != `#{true, 1, 3, a}` {
+		t.Errorf("wrong Inspect, got=%s", evaluated.Inspect())
+	}
+}
+
+func TestRanges(t *testing.T) {
+	bounds := "let min = -9223372036854775807 - 1; let max = 9223372036854775807; "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"len(0..10)", 10},
+		{"len(0..=10)", 11},
+		{"len(0..10 step 3)", 4},
+		{"len(10..0)", 0},
+		{"len(10..0 step -1)", 10},
+		{"len(10..=0 step -2)", 6},
+		{"len(0..1000000000000)", 1000000000000},
+		{"[x for x in 0..5]", []int{0, 1, 2, 3, 4}},
+		{"[x for x in 1..=9 step 4]", []int{1, 5, 9}},
+		{"[x for x in 3..0 step -1]", []int{3, 2, 1}},
+		{"[i for i, x in 5..8]", []int{0, 1, 2}},
+		{"let n = 4; [x * x for x in 0..n - 1]", []int{0, 1, 4}},
+		{"let step = 5; [x for x in 0..10 step step]", []int{0, 5}},
+		{"(0..10)[3]", 3},
+		{"(0..10 step 2)[-1]", 8},
+		{"(0..1000000000000)[999999999999]", 999999999999},
+		{"5 in 0..10", true},
+		{"10 in 0..10", false},
+		{"10 in 0..=10", true},
+		{"3 in 0..10 step 2", false},
+		{"-4 in 0..-10 step -2", true},
+		{"\"a\" in 0..3", false},
+		{"[1, 2, 3, 4, 5][1..3]", []int{2, 3}},
+		{"[1, 2, 3, 4, 5][1..=3]", []int{2, 3, 4}},
+		{"[1, 2, 3, 4, 5][0..5 step 2]", []int{1, 3, 5}},
+		{"[1, 2, 3, 4, 5][-2..10]", []int{4, 5}},
+		{"[1, 2, 3][-1..=0 step -1]", []int{3, 2, 1}},
+		{"[1, 2, 3][2..0]", []int{}},
+		{"\"monkey\"[0..3]", "mon"},
+		{"\"monkey\"[-1..=0 step -2]", "yko"},
+		{"try { 0..\"a\" } catch (e) { e.message }", "range bounds must be INTEGER, got STRING"},
+		{"try { 0..3 step 0 } catch (e) { e.message }", "range step must not be 0"},
+		{"try { 5[0..1] } catch (e) { e.message }", "index operator not supported: INTEGER"},
+		{"(0..3)[5]", nil},
+		// at the bounds of INTEGER
+		{bounds + "try { len(min..max) } catch (e) { e.message }",
+			"len of -9223372036854775808..9223372036854775807 is too large for an INTEGER"},
+		{bounds + "try { len(0..=max) } catch (e) { e.message }", "len of 0..=9223372036854775807 is too large for an INTEGER"},
+		{bounds + "len(0..max)", 9223372036854775807},
+		{bounds + "len(min..max step max)", 3},
+		{bounds + "(min..=max)[-1]", 9223372036854775807},
+		{bounds + "(min..=max)[0]", -9223372036854775808},
+		{bounds + "(min..max)[-1]", 9223372036854775806},
+		{bounds + "(max..=min step -1)[-1]", -9223372036854775808},
+		{bounds + "5 in min..10", true},
+		{bounds + "max in min..=max", true},
+		{bounds + "max in min..max", false},
+		{bounds + "min in max..=min step -1", true},
+		{bounds + "-1 in min..max step max", true},
+		{bounds + "0 in min..max step max", false},
+		{bounds + "[x for x in max - 2..=max]", []int{9223372036854775805, 9223372036854775806, 9223372036854775807}},
+		{bounds + "[1, 2, 3][0..=max]", []int{1, 2, 3}},
+		{bounds + "[1, 2, 3][min..=max]", []int{1, 2, 3}},
+		{bounds + "[1, 2, 3][0..max step max]", []int{1}},
+		{bounds + "[1, 2, 3][-1..=min step -1]", []int{3, 2, 1}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%s: expected %q, got=%+v", tt.input, expected, evaluated)
+			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok || len(array.Elements) != len(expected) {
+				t.Errorf("%s: expected %v, got=%+v", tt.input, expected, evaluated)
+				continue
+			}
+			for i, el := range expected {
+				testIntegerObject(t, array.Elements[i], int64(el))
+			}
+		}
+	}
+
+	for input, expected := range map[string]string{
+		"0..10":        "0..10",
+		"1..=5 step 2": "1..=5 step 2",
+		"5..0 step -1": "5..0 step -1",
+	} {
+		evaluated := testEval(input)
+		if evaluated.Inspect() != expected {
+			t.Errorf("wrong Inspect, expected=%s, got=%s", expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestIterators(t *testing.T) {
+	counter := `let counter = fn(n) {
+		let s = {"i": 0};
+		fn() { s.i = s.i + 1; if (s.i > n) { {"done": true} } else { {"value": s.i, "done": false} } }
+	};
+	`
+	gen := "let gen = fn(n) { for (i in 0..n) { yield i * 10 } }; "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let h = {"t": 0}; for (x in [1, 2, 3]) { h.t = h.t + x }; h.t`, 6},
+		{`let f = fn() { let h = {"t": 0}; for (i in 0..5) { h.t = h.t + i }; h.t }; f()`, 10},
+		{`let h = {"t": 0}; for (i, x in [5, 6]) { h.t = h.t + i * x }; h.t`, 6},
+		{`let h = {"t": ""}; for (k, v in {"a": "b"}) { h.t = k + v }; h.t`, "ab"},
+		{`let h = {"t": 0}; for (x in []) { h.t = 1 }; h.t`, 0},
+		{"let find = fn(xs) { for (x in xs) { if (x > 2) { return x } }; -1 }; find([1, 5, 3])", 5},
+		{"let find = fn(xs) { for (x in xs) { if (x > 2) { return x } }; -1 }; find([1])", -1},
+		{`let h = {"t": 0}; for (x in 1..=3) { for (y in 1..=x) { h.t = h.t + y } }; h.t`, 10},
+		// closures made in the body see their own iteration's variables
+		{`let s = {"fs": []}; for (x in [1, 2, 3]) { s.fs = push(s.fs, fn() { x }) }; [s.fs[0](), s.fs[1](), s.fs[2]()]`, []int{1, 2, 3}},
+		{`let s = {"fs": []}; for (x in [1, 2]) { s.fs = push(s.fs, fn() { x }) }; let x = 42; s.fs[0]()`, 1},
+		{`let f = fn() { let s = {"fs": []}; for (x in [1, 2]) { s.fs = push(s.fs, fn() { x }) }; s.fs }; let fs = f(); [fs[0](), fs[1]()]`, []int{1, 2}},
+		// generators, closures and anything with a next method are iterable
+		{gen + "[...gen(3)]", []int{0, 10, 20}},
+		{gen + `let h = {"t": 0}; for (x in gen(4)) { h.t = h.t + x }; h.t`, 60},
+		{gen + "[x + 1 for x in gen(2)]", []int{1, 11}},
+		{gen + "let g = gen(3); g.next(); [...g]", []int{10, 20}},
+		{counter + "[...counter(3)]", []int{1, 2, 3}},
+		{counter + "#{...counter(2)} == #{1, 2}", true},
+		{counter + "let f = fn(a, b) { a * b }; f(...counter(2))", 2},
+		{counter + "{k: v for k, v in counter(2)}[1]", 2},
+		{`let it = {"n": 0, "next": fn() { {"done": true} }}; [...it]`, []int{}},
+		{`let it = {"next": 1}; len([...it])`, 1},
+		{`class Countdown {
+			init(n) { self.n = n }
+			next() { self.n = self.n - 1; if (self.n < 0) { {"done": true} } else { {"value": self.n, "done": false} } }
+		}
+		[...Countdown(3)]`, []int{2, 1, 0}},
+		// the collection builtins take any iterable
+		{gen + "len(gen(4))", 4},
+		{gen + "first(gen(3))", 0},
+		{"let nat = fn(i) { yield i; yield* nat(i + 1) }; first(nat(5))", 5},
+		{gen + "let g = gen(3); first(g); [...g]", []int{10, 20}},
+		{gen + "last(gen(3))", 20},
+		{gen + "rest(gen(3))", []int{10, 20}},
+		{counter + "union(counter(2), [3]) == #{1, 2, 3}", true},
+		{`try { [...fn() { throw "x" }] } catch (e) { e }`, "x"},
+		{"try { [...fn() { 1 }] } catch (e) { e.message }", "next must return a HASH with value and done, got INTEGER"},
+		{"try { for (x in 1) { x } } catch (e) { e.message }", "cannot iterate over INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%s: expected %q, got=%+v", tt.input, expected, evaluated)
+			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok || len(array.Elements) != len(expected) {
+				t.Errorf("%s: expected %v, got=%+v", tt.input, expected, evaluated)
+				continue
+			}
+			for i, el := range expected {
+				testIntegerObject(t, array.Elements[i], int64(el))
+			}
+		}
+	}
+}
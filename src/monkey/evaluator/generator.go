@@ -0,0 +1,171 @@
+package evaluator
+
+import (
+	"runtime"
+
+	"sawyer.com/v9/src/monkey/ast"
+	"sawyer.com/v9/src/monkey/object"
+)
+
+type generatorStep struct {
+	value object.Object
+	done  bool
+}
+
+// a generator evaluates its function's body on a goroutine of its own.
+// a yield hands its value over and waits to be resumed. env holds the
+// arguments, and the yield of the body as "yield", a keyword so it can't
+// clash with a user's name.
+// closing stop ends the goroutine at the yield it's paused at. close does,
+// and so does a finalizer when the generator is dropped unfinished
+func newGenerator(fn *object.Function, env *object.Environment) *object.Generator {
+	sent := make(chan object.Object)
+	steps := make(chan generatorStep)
+	stop := make(chan struct{})
+	env.Set("yield", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		select {
+		case steps <- generatorStep{value: args[0]}:
+		case <-stop:
+			runtime.Goexit()
+		}
+		select {
+		case value := <-sent:
+			return value
+		case <-stop:
+			runtime.Goexit()
+		}
+		return nil
+	}})
+
+	started, running, done := false, false, false
+	resume := func(value object.Object) (object.Object, bool) {
+		if done {
+			return NULL, true
+		}
+		if running {
+			return newError("generator is already running"), true
+		}
+		running = true
+		if started {
+			sent <- value
+		} else {
+			started = true
+			go func() {
+				result := runDeferred(fn, env, trampoline(unwrapReturnValue(Eval(fn.Body, env))))
+				if result == nil {
+					result = NULL
+				}
+				steps <- generatorStep{value: result, done: true}
+			}()
+		}
+		step := <-steps
+		running = false
+		done = step.done
+		return step.value, step.done
+	}
+	closeGenerator := func() bool {
+		if running {
+			return false
+		}
+		if started && !done {
+			close(stop)
+		}
+		done = true
+		return true
+	}
+	g := &object.Generator{Resume: resume, Close: closeGenerator}
+	runtime.SetFinalizer(g, func(*object.Generator) { closeGenerator() })
+	return g
+}
+
+func evalYieldExpression(node *ast.YieldExpression, env *object.Environment) object.Object {
+	if node.Delegate {
+		return evalYieldDelegate(node, env)
+	}
+	var value object.Object = NULL
+	if node.Value != nil {
+		value = Eval(node.Value, env)
+		if isError(value) {
+			return value
+		}
+	}
+	yield, ok := env.Get("yield")
+	if !ok {
+		return newError("yield outside of a generator")
+	}
+	return yield.(*object.Builtin).Fn(value)
+}
+
+// yield* g calls g.next() until it's done, yielding every value on the way.
+// it evaluates to what g returns
+func evalYieldDelegate(node *ast.YieldExpression, env *object.Environment) object.Object {
+	delegate := Eval(node.Value, env)
+	if isError(delegate) {
+		return delegate
+	}
+	yield, ok := env.Get("yield")
+	if !ok {
+		return newError("yield outside of a generator")
+	}
+	next := evalMemberExpression(delegate, "next")
+	if isError(next) {
+		return next
+	}
+	for {
+		step := applyFunction(next, []object.Object{})
+		if isError(step) {
+			return step
+		}
+		done := evalMemberExpression(step, "done")
+		if isError(done) {
+			return done
+		}
+		value := evalMemberExpression(step, "value")
+		if isError(value) {
+			return value
+		}
+		if isTruthy(done) {
+			return value
+		}
+		yield.(*object.Builtin).Fn(value)
+	}
+}
+
+// gen.next() and gen.next(v), the result is {"value": v, "done": false},
+// or what the function returned and done when it's finished
+func generatorNext(g *object.Generator) *object.Builtin {
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		var sent object.Object = NULL
+		switch len(args) {
+		case 0:
+		case 1:
+			sent = args[0]
+		default:
+			return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+		}
+		value, done := g.Resume(sent)
+		if isError(value) {
+			return value
+		}
+		valueKey := &object.String{Value: "value"}
+		doneKey := &object.String{Value: "done"}
+		return &object.Hash{Pairs: map[object.HashKey]object.HashPair{
+			valueKey.HashKey(): {Key: valueKey, Value: value},
+			doneKey.HashKey():  {Key: doneKey, Value: nativeBoolToBooleanObject(done)},
+		}}
+	}}
+}
+
+// gen.close() ends it, so the next next() is done. a paused yield never
+// resumes, and the rest of the function doesn't run
+func generatorClose(g *object.Generator) *object.Builtin {
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0", len(args))
+		}
+		if !g.Close() {
+			return newError("generator is already running")
+		}
+		return NULL
+	}}
+}
@@ -0,0 +1,58 @@
+package evaluator
+
+import (
+	"sawyer.com/v9/src/monkey/object"
+)
+
+// an iterator over obj: the builtin iterables, and anything with a next
+// method returning {"value": v, "done": false} until {"done": true},
+// like a generator. a function on its own is a next method, a closure
+// counting up is an iterator
+func iterate(obj object.Object) (*object.Iterator, *object.Error) {
+	next, ok := nextMethod(obj)
+	if !ok {
+		iterator, ok := object.NewIterator(obj)
+		if !ok {
+			return nil, newError("cannot iterate over %s", obj.Type())
+		}
+		return iterator, nil
+	}
+	return object.NewStepIterator(func() (object.Object, bool, *object.Error) {
+		result := applyFunction(next, nil)
+		if errObj, ok := result.(*object.Error); ok {
+			return nil, false, errObj
+		}
+		return object.IteratorResult(result)
+	}), nil
+}
+
+// the next method of obj, when it has one. a hash without a function
+// under "next" is iterated over its keys
+func nextMethod(obj object.Object) (object.Object, bool) {
+	switch obj := obj.(type) {
+	case *object.Generator:
+		return generatorNext(obj), true
+	case *object.Function, *object.Builtin, *object.BoundMethod:
+		return obj, true
+	case *object.Instance:
+		return obj.Get("next")
+	case *object.Hash:
+		pair, ok := obj.Pairs[(&object.String{Value: "next"}).HashKey()]
+		if !ok {
+			return nil, false
+		}
+		switch pair.Value.(type) {
+		case *object.Function, *object.Builtin, *object.BoundMethod:
+			return pair.Value, true
+		}
+	}
+	return nil, false
+}
+
+// what ended the iteration, an error from a next method or nil
+func iteratorError(iterator *object.Iterator) object.Object {
+	if errObj := iterator.Err(); errObj != nil {
+		return errObj
+	}
+	return nil
+}
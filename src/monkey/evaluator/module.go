@@ -0,0 +1,40 @@
+package evaluator
+
+import (
+	"errors"
+
+	"sawyer.com/v9/src/monkey/ast"
+	"sawyer.com/v9/src/monkey/module"
+	"sawyer.com/v9/src/monkey/object"
+)
+
+// Modules loads what import statements ask for, a module is evaluated once.
+// set its SearchPath to configure where modules are found
+var Modules *module.Loader
+
+func init() {
+	// not in the declaration, evaluating a module refers back to Modules
+	Modules = NewLoader(module.DefaultSearchPath())
+}
+
+// a loader that evaluates modules
+func NewLoader(searchPath []string) *module.Loader {
+	return module.NewLoader(evalModule, searchPath)
+}
+
+// every module is evaluated in an environment of its own,
+// its functions keep it as their closure wherever they're called
+func evalModule(name string, program *ast.Program) (*object.Module, error) {
+	env := object.NewEnvironment()
+	result := Eval(program, env)
+	if isError(result) {
+		return nil, errors.New(result.(*object.Error).Message)
+	}
+
+	mod := &object.Module{Name: name, Exports: make(map[string]object.Object)}
+	for _, name := range program.Exports() {
+		value, _ := env.Get(name)
+		mod.Exports[name] = value
+	}
+	return mod, nil
+}
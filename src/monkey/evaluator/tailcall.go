@@ -0,0 +1,111 @@
+package evaluator
+
+import (
+	"sawyer.com/v9/src/monkey/ast"
+	"sawyer.com/v9/src/monkey/object"
+	"sawyer.com/v9/src/monkey/token"
+)
+
+// tailCall is a call in tail position that hasn't been applied yet.
+// the function body hands it back, and applyFunction applies it in a loop,
+// so a recursion in tail position doesn't grow the go stack
+type tailCall struct {
+	fn       object.Object
+	args     []object.Object
+	keywords []string
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// apply the tail calls handed back until there's a value
+func trampoline(result object.Object) object.Object {
+	for {
+		call, ok := result.(*tailCall)
+		if !ok {
+			return result
+		}
+		result = callFunction(call.fn, call.args, call.keywords)
+	}
+}
+
+// a returned tail call applied, where something has to see its result.
+// an error it ends with replaces the return, so a try can catch it
+func forceReturn(result object.Object) object.Object {
+	returnValue, ok := result.(*object.ReturnValue)
+	if !ok {
+		return result
+	}
+	if _, ok := returnValue.Value.(*tailCall); !ok {
+		return result
+	}
+	value := trampoline(returnValue.Value)
+	if isError(value) {
+		return value
+	}
+	return &object.ReturnValue{Value: value}
+}
+
+// a function's body, the value of its last statement is in tail position
+func evalFunctionBody(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+	for i, statement := range block.Statements {
+		if es, ok := statement.(*ast.ExpressionStatement); ok && i == len(block.Statements)-1 {
+			return evalTail(es.Expression, env)
+		}
+		result = Eval(statement, env)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+	return result
+}
+
+// an expression in tail position. a call is handed back as a tailCall,
+// an if passes the tail position on to its branches
+func evalTail(node ast.Expression, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		// a pipeline stage is applied here, an error is pointed at it
+		if node.Token.Type == token.PIPE {
+			return Eval(node, env)
+		}
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		if isEval(function, node) {
+			return evalSource(args, env)
+		}
+		return &tailCall{fn: function, args: args, keywords: keywordNames(node.Arguments)}
+	case *ast.IfExpression:
+		condition := Eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if isTruthy(condition) {
+			return evalTailBlock(node.Consequence, object.NewEnclosedEnvironment(env))
+		} else if node.Alternative != nil {
+			return evalTailBlock(node.Alternative, object.NewEnclosedEnvironment(env))
+		}
+		return NULL
+	default:
+		return Eval(node, env)
+	}
+}
+
+// a block that is empty or ends with a let is null
+func evalTailBlock(block *ast.BlockStatement, env *object.Environment) object.Object {
+	result := evalFunctionBody(block, env)
+	if result == nil {
+		return NULL
+	}
+	return result
+}
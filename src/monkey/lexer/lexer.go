@@ -10,10 +10,12 @@ type Lexer struct {
 	position     int  // current position in input (points to current ch)
 	readPosition int  // current reading position in input (after current char)
 	ch           byte // current char under examination
+	line         int  // line of current ch, for error positions
+	column       int  // column of current ch
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar() // initialize lexer
 	return l
 }
@@ -21,6 +23,11 @@ func New(input string) *Lexer {
 // todo Unicode or Emoji support
 // ASCII only
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // reached the end of the input, set 0 which is ASCII code for the "NUL" character
 	} else {
@@ -44,20 +51,32 @@ func (l *Lexer) readString() string {
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 	l.skipWhitespace()
+	line, column := l.line, l.column
 	switch l.ch {
 	case '=':
-		// equal or assign token
+		// equal, arrow or assign token
 		if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			tok = token.Token{Type: token.EQ, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: string(ch) + string(l.ch)}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
 		tok = newToken(token.PLUS, l.ch)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		// minus, or the arrow before a return type
+		if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.THIN_ARROW, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '!':
 		// not equal or bang token
 		if l.peekChar() == '=' {
@@ -67,6 +86,15 @@ func (l *Lexer) NextToken() token.Token {
 		} else {
 			tok = newToken(token.BANG, l.ch)
 		}
+	case '|':
+		// pipeline operator, a single | separates the types of a union
+		if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.PIPE, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.BAR, l.ch)
+		}
 	case '/':
 		tok = newToken(token.SLASH, l.ch)
 	case '*':
@@ -79,12 +107,38 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(2) == '.' {
+			// spread operation
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else if l.peekChar() == '.' && l.peekCharAt(2) == '=' {
+			// inclusive range
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.DOTDOT_EQ, Literal: "..="}
+		} else if l.peekChar() == '.' {
+			// range
+			l.readChar()
+			tok = token.Token{Type: token.DOTDOT, Literal: ".."}
+		} else {
+			// member access operation
+			tok = newToken(token.DOT, l.ch)
+		}
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
+	case '#':
+		if l.peekChar() == '{' {
+			l.readChar()
+			tok = token.Token{Type: token.SET_LBRACE, Literal: "#{"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
 	case ':':
@@ -106,17 +160,20 @@ func (l *Lexer) NextToken() token.Token {
 			// identifiers or keywords
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Line, tok.Column = line, column
 			return tok
 		} else if isDigit(l.ch) {
 			// integer literals
 			tok.Type = token.INT
 			tok.Literal = l.readNumber()
+			tok.Line, tok.Column = line, column
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
 	l.readChar()
+	tok.Line, tok.Column = line, column
 	return tok
 }
 
@@ -142,6 +199,15 @@ func (l *Lexer) peekChar() byte {
 	}
 }
 
+// peekCharAt(1) equals to peekChar()
+func (l *Lexer) peekCharAt(n int) byte {
+	pos := l.position + n
+	if pos >= len(l.input) {
+		return 0
+	}
+	return l.input[pos]
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.readChar()
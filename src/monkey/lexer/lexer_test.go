@@ -28,6 +28,9 @@ func TestNextToken(t *testing.T) {
     "foo bar"
     [1, 2];
     {"foo": "bar"}
+    config.port;
+    x => x;
+    [...a];
    `
 
 	tests := []struct {
@@ -120,6 +123,19 @@ func TestNextToken(t *testing.T) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.IDENT, "config"},
+		{token.DOT, "."},
+		{token.IDENT, "port"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "x"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACKET, "["},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "a"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
 		{token.EOF, ""},
 	}
 	l := New(input)
@@ -139,3 +155,125 @@ func TestNextToken(t *testing.T) {
 	}
 
 }
+
+func TestPipeAndPositions(t *testing.T) {
+	input := `xs |> f(1)
+  | y`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.IDENT, "xs", 1, 1},
+		{token.PIPE, "|>", 1, 4},
+		{token.IDENT, "f", 1, 7},
+		{token.LPAREN, "(", 1, 8},
+		{token.INT, "1", 1, 9},
+		{token.RPAREN, ")", 1, 10},
+		{token.BAR, "|", 2, 3},
+		{token.IDENT, "y", 2, 5},
+		{token.EOF, "", 2, 6},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestTypeAnnotationTokens(t *testing.T) {
+	input := `fn(x: int | string) -> bool { x-1 }`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COLON, ":"},
+		{token.IDENT, "int"},
+		{token.BAR, "|"},
+		{token.IDENT, "string"},
+		{token.RPAREN, ")"},
+		{token.THIN_ARROW, "->"},
+		{token.IDENT, "bool"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.MINUS, "-"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestSetTokens(t *testing.T) {
+	input := `#{1} x in s #`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.SET_LBRACE, "#{"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.IDENT, "x"},
+		{token.IN, "in"},
+		{token.IDENT, "s"},
+		{token.ILLEGAL, "#"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestRangeTokens(t *testing.T) {
+	input := `0..n 1..=9 [...xs] a.b`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "0"},
+		{token.DOTDOT, ".."},
+		{token.IDENT, "n"},
+		{token.INT, "1"},
+		{token.DOTDOT_EQ, "..="},
+		{token.INT, "9"},
+		{token.LBRACKET, "["},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "xs"},
+		{token.RBRACKET, "]"},
+		{token.IDENT, "a"},
+		{token.DOT, "."},
+		{token.IDENT, "b"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
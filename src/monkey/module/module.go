@@ -0,0 +1,129 @@
+package module
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sawyer.com/v9/src/monkey/ast"
+	"sawyer.com/v9/src/monkey/checker"
+	"sawyer.com/v9/src/monkey/lexer"
+	"sawyer.com/v9/src/monkey/object"
+	"sawyer.com/v9/src/monkey/parser"
+)
+
+// Exec runs the program of a module, it's where the evaluator and the vm differ.
+// it returns the module with its exported values
+type Exec func(name string, program *ast.Program) (*object.Module, error)
+
+// Loader finds, parses and runs modules. every module runs once,
+// importing it again returns the cached one
+type Loader struct {
+	// directories searched in order, after the directory of the importing module
+	SearchPath []string
+
+	exec  Exec
+	cache map[string]*object.Module // by absolute file path
+	// modules being loaded, the last one is importing right now
+	loading []loadingModule
+}
+
+type loadingModule struct {
+	name string
+	file string
+}
+
+func NewLoader(exec Exec, searchPath []string) *Loader {
+	return &Loader{
+		SearchPath: searchPath,
+		exec:       exec,
+		cache:      make(map[string]*object.Module),
+	}
+}
+
+// the current directory followed by the directories in $MONKEY_PATH
+func DefaultSearchPath() []string {
+	path := []string{"."}
+	for _, dir := range filepath.SplitList(os.Getenv("MONKEY_PATH")) {
+		if dir != "" {
+			path = append(path, dir)
+		}
+	}
+	return path
+}
+
+func (l *Loader) Import(name string) (*object.Module, error) {
+	file, err := l.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if mod, ok := l.cache[file]; ok {
+		return mod, nil
+	}
+	for i, m := range l.loading {
+		if m.file == file {
+			names := []string{}
+			for _, m := range l.loading[i:] {
+				names = append(names, m.name)
+			}
+			names = append(names, name)
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(names, " -> "))
+		}
+	}
+
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("module %s: %s", name, err)
+	}
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("module %s: %s", name, strings.Join(p.Errors(), "; "))
+	}
+	// type errors are reported before the module runs
+	if errs := checker.New().Check(program); len(errs) != 0 {
+		return nil, fmt.Errorf("module %s: %s", name, strings.Join(errs, "; "))
+	}
+
+	l.loading = append(l.loading, loadingModule{name: name, file: file})
+	mod, err := l.exec(name, program)
+	l.loading = l.loading[:len(l.loading)-1]
+	if err != nil {
+		return nil, fmt.Errorf("module %s: %s", name, err)
+	}
+	l.cache[file] = mod
+	return mod, nil
+}
+
+// find the file of a module, relative paths are looked up in the directory
+// of the importing module first, then along the search path
+func (l *Loader) resolve(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		if isFile(name) {
+			return filepath.Clean(name), nil
+		}
+		return "", fmt.Errorf("module not found: %s", name)
+	}
+
+	dirs := []string{}
+	if len(l.loading) > 0 {
+		dirs = append(dirs, filepath.Dir(l.loading[len(l.loading)-1].file))
+	}
+	dirs = append(dirs, l.SearchPath...)
+	for _, dir := range dirs {
+		file, err := filepath.Abs(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if isFile(file) {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("module not found: %s", name)
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,130 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sawyer.com/v9/src/monkey/ast"
+	"sawyer.com/v9/src/monkey/object"
+)
+
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, source := range files {
+		file := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(file), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(file, []byte(source), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// an Exec that only follows imports, and counts how often each module runs
+func importingExec(l **Loader, runs map[string]int) Exec {
+	return func(name string, program *ast.Program) (*object.Module, error) {
+		runs[name]++
+		for _, s := range program.Statements {
+			if is, ok := s.(*ast.ImportStatement); ok {
+				_, err := (*l).Import(is.Path)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		return &object.Module{Name: name, Exports: map[string]object.Object{}}, nil
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"a.monkey":          `import "lib/b.monkey" as b; import "lib/b.monkey" as b2;`,
+		"lib/b.monkey":      `import "c.monkey" as c;`,
+		"lib/c.monkey":      `let c = 1;`,
+		"other/c.monkey":    `let c = 2;`,
+		"other/d.monkey":    `let d = 1;`,
+		"broken.monkey":     `let = 1;`,
+		"typed.monkey":      `let n: int = "one";`,
+		"cycle/x.monkey":    `import "y.monkey" as y;`,
+		"cycle/y.monkey":    `import "z.monkey" as z;`,
+		"cycle/z.monkey":    `import "x.monkey" as x;`,
+		"cycle/self.monkey": `import "self.monkey" as me;`,
+	})
+	runs := make(map[string]int)
+	var l *Loader
+	l = NewLoader(importingExec(&l, runs), []string{dir, filepath.Join(dir, "other")})
+
+	a, err := l.Import("a.monkey")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if a.Name != "a.monkey" {
+		t.Errorf("wrong module name. got=%q", a.Name)
+	}
+	// lib/c.monkey is found next to lib/b.monkey before other/c.monkey
+	for _, name := range []string{"a.monkey", "lib/b.monkey", "c.monkey"} {
+		if runs[name] != 1 {
+			t.Errorf("module %s should run once, ran %d times", name, runs[name])
+		}
+	}
+	again, err := l.Import("a.monkey")
+	if err != nil || again != a || runs["a.monkey"] != 1 {
+		t.Errorf("expected the cached module, got=%v, err=%v", again, err)
+	}
+	_, err = l.Import(filepath.Join(dir, "a.monkey"))
+	if err != nil || runs["a.monkey"] != 1 {
+		t.Errorf("expected an absolute path to hit the cache too, err=%v", err)
+	}
+	// the search path is searched in order
+	_, err = l.Import("d.monkey")
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"missing.monkey", "module not found: missing.monkey"},
+		{"broken.monkey", "module broken.monkey: expected next token to be IDENT, got = instead; " +
+			"no prefix parse function for = found"},
+		// checked before it runs
+		{"typed.monkey", "module typed.monkey: 1:5: cannot use string as int in let n"},
+		{"cycle/x.monkey", "module cycle/x.monkey: module y.monkey: module z.monkey: " +
+			"import cycle: cycle/x.monkey -> y.monkey -> z.monkey -> x.monkey"},
+		{"cycle/self.monkey", "module cycle/self.monkey: import cycle: cycle/self.monkey -> self.monkey"},
+	}
+	for _, tt := range tests {
+		_, err := l.Import(tt.name)
+		if err == nil {
+			t.Errorf("expected an error importing %s", tt.name)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+	if len(l.loading) != 0 {
+		t.Errorf("modules left loading: %+v", l.loading)
+	}
+}
+
+func TestDefaultSearchPath(t *testing.T) {
+	t.Setenv("MONKEY_PATH", "/a"+string(os.PathListSeparator)+"/b")
+	path := DefaultSearchPath()
+	expected := []string{".", "/a", "/b"}
+	if len(path) != len(expected) {
+		t.Fatalf("wrong search path. want=%v, got=%v", expected, path)
+	}
+	for i := range expected {
+		if path[i] != expected[i] {
+			t.Errorf("wrong search path. want=%v, got=%v", expected, path)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package object
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/big"
+)
+
+// BigInt is an integer that doesn't fit in an int64. integer arithmetic
+// promotes a result that overflows to one, and gives an Integer again
+// once it fits, so a value has one representation
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Type() ObjectType { return BIGINT_OBJ }
+func (b *BigInt) Inspect() string  { return b.Value.String() }
+
+func (b *BigInt) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write(b.Value.Bytes())
+	if b.Value.Sign() < 0 {
+		h.Write([]byte{'-'})
+	}
+	return HashKey{Type: b.Type(), Value: h.Sum64()}
+}
+
+// NewInteger is v as an Integer when it fits in an int64, as a BigInt otherwise
+func NewInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &BigInt{Value: v}
+}
+
+// IsInteger tells whether obj is an Integer or a BigInt
+func IsInteger(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *BigInt:
+		return true
+	}
+	return false
+}
+
+func bigValue(obj Object) *big.Int {
+	if b, ok := obj.(*BigInt); ok {
+		return b.Value
+	}
+	return big.NewInt(obj.(*Integer).Value)
+}
+
+// IntegerArithmetic applies +, -, * or / to two integers. when both are
+// Integers and the result fits in an int64 it's an Integer, otherwise the
+// operation is done again on big integers
+func IntegerArithmetic(operator string, left, right Object) (Object, error) {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		if result, ok := int64Arithmetic(operator, l.Value, r.Value); ok {
+			return &Integer{Value: result}, nil
+		}
+	}
+	a, b := bigValue(left), bigValue(right)
+	result := new(big.Int)
+	switch operator {
+	case "+":
+		result.Add(a, b)
+	case "-":
+		result.Sub(a, b)
+	case "*":
+		result.Mul(a, b)
+	case "/":
+		if b.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		// truncated like int64 division
+		result.Quo(a, b)
+	default:
+		return nil, fmt.Errorf("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+	return NewInteger(result), nil
+}
+
+// a op b, not ok when it overflows, divides by zero or op isn't arithmetic
+func int64Arithmetic(operator string, a, b int64) (int64, bool) {
+	switch operator {
+	case "+":
+		result := a + b
+		return result, (result > a) == (b > 0)
+	case "-":
+		result := a - b
+		return result, (result < a) == (b > 0)
+	case "*":
+		if a == 0 || b == 0 {
+			return 0, true
+		}
+		result := a * b
+		return result, result/b == a && !(a == -1 && b == math.MinInt64) && !(b == -1 && a == math.MinInt64)
+	case "/":
+		if b == 0 || (a == math.MinInt64 && b == -1) {
+			return 0, false
+		}
+		return a / b, true
+	}
+	return 0, false
+}
+
+// CompareIntegers is -1, 0 or 1 as left is less than, equal to or greater than right
+func CompareIntegers(left, right Object) int {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		switch {
+		case l.Value < r.Value:
+			return -1
+		case l.Value > r.Value:
+			return 1
+		}
+		return 0
+	}
+	return bigValue(left).Cmp(bigValue(right))
+}
+
+// NegateInteger is -obj, -math.MinInt64 is a BigInt
+func NegateInteger(obj Object) Object {
+	if i, ok := obj.(*Integer); ok && i.Value != math.MinInt64 {
+		return &Integer{Value: -i.Value}
+	}
+	return NewInteger(new(big.Int).Neg(bigValue(obj)))
+}
@@ -18,6 +18,14 @@ var Builtins = []struct {
 					return &Integer{Value: int64(len(arg.Elements))}
 				case *String:
 					return &Integer{Value: int64(len(arg.Value))}
+				case *Set:
+					return &Integer{Value: int64(len(arg.Elements))}
+				case *Range:
+					length, ok := arg.Len()
+					if !ok {
+						return newError("len of %s is too large for an INTEGER", arg.Inspect())
+					}
+					return &Integer{Value: length}
 				default:
 					return newError("argument to `len` not supported, got %s", args[0].Type())
 
@@ -112,6 +120,159 @@ var Builtins = []struct {
 			},
 		},
 	},
+	{
+		"delete",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				if args[0].Type() != HASH_OBJ {
+					return newError("argument to `delete` must be HASH, got %s", args[0].Type())
+				}
+				hash := args[0].(*Hash)
+				key, ok := args[1].(Hashable)
+				if !ok {
+					return newError("unusable as hash key: %s", args[1].Type())
+				}
+				// removes the pair in place, returns the removed value
+				pair, ok := hash.Pairs[key.HashKey()]
+				if !ok {
+					return nil
+				}
+				delete(hash.Pairs, key.HashKey())
+				return pair.Value
+			},
+		},
+	},
+	{
+		// running a function takes an engine, the vm and the evaluator
+		// each bind their own spawn in its place
+		"spawn",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return newError("spawn is not available here")
+			},
+		},
+	},
+	{
+		"channel",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+				}
+				size := int64(0)
+				if len(args) == 1 {
+					integer, ok := args[0].(*Integer)
+					if !ok || integer.Value < 0 {
+						return newError("argument to `channel` must be a non-negative INTEGER, got %s",
+							args[0].Inspect())
+					}
+					size = integer.Value
+				}
+				return &Channel{Ch: make(chan Object, size)}
+			},
+		},
+	},
+	{
+		"send",
+		&Builtin{
+			Fn: func(args ...Object) (result Object) {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+				ch, ok := args[0].(*Channel)
+				if !ok {
+					return newError("argument to `send` must be CHANNEL, got %s", args[0].Type())
+				}
+				defer func() {
+					// sending on a closed channel panics in go
+					if recover() != nil {
+						result = newError("send on closed channel")
+					}
+				}()
+				ch.Ch <- args[1]
+				return nil
+			},
+		},
+	},
+	{
+		"recv",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				ch, ok := args[0].(*Channel)
+				if !ok {
+					return newError("argument to `recv` must be CHANNEL, got %s", args[0].Type())
+				}
+				// null once the channel is closed and drained
+				return <-ch.Ch
+			},
+		},
+	},
+	{
+		"close",
+		&Builtin{
+			Fn: func(args ...Object) (result Object) {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				ch, ok := args[0].(*Channel)
+				if !ok {
+					return newError("argument to `close` must be CHANNEL, got %s", args[0].Type())
+				}
+				defer func() {
+					if recover() != nil {
+						result = newError("close of closed channel")
+					}
+				}()
+				close(ch.Ch)
+				return nil
+			},
+		},
+	},
+	{
+		// eval(src, env?) compiles or evaluates src, so each engine binds its own
+		"eval",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				return newError("eval is not available here")
+			},
+		},
+	},
+	{
+		"union",
+		&Builtin{Fn: setOperation("union", Union)},
+	},
+	{
+		"intersection",
+		&Builtin{Fn: setOperation("intersection", Intersection)},
+	},
+	{
+		"difference",
+		&Builtin{Fn: setOperation("difference", Difference)},
+	},
+}
+
+// a builtin taking two sets, named name in its errors
+func setOperation(name string, op func(a, b *Set) *Set) BuiltinFunction {
+	return func(args ...Object) Object {
+		if len(args) != 2 {
+			return newError("wrong number of arguments. got=%d, want=2", len(args))
+		}
+		a, ok := args[0].(*Set)
+		if !ok {
+			return newError("arguments to `%s` must be SET, got %s", name, args[0].Type())
+		}
+		b, ok := args[1].(*Set)
+		if !ok {
+			return newError("arguments to `%s` must be SET, got %s", name, args[1].Type())
+		}
+		return op(a, b)
+	}
 }
 
 func newError(format string, a ...interface{}) *Error {
@@ -0,0 +1,144 @@
+package object
+
+// Iterate is an engine's way to iterate over obj. besides what NewIterator
+// takes, it takes what has to be called to iterate: a generator, an object
+// with a next method, or a function that's a next method on its own.
+// the error is like a builtin's, a throw keeps what was thrown
+type Iterate func(obj Object) (*Iterator, *Error)
+
+// NewStepIterator is an iterator over the values step returns until it's
+// done, numbered like an array's elements. an error from step ends it too,
+// and Err returns it
+func NewStepIterator(step func() (Object, bool, *Error)) *Iterator {
+	it := &Iterator{}
+	i, finished := 0, false
+	it.next = func() (Object, Object, bool) {
+		if finished {
+			return nil, nil, false
+		}
+		value, done, err := step()
+		if err != nil || done {
+			finished = true
+			it.err = err
+			return nil, nil, false
+		}
+		i++
+		return &Integer{Value: int64(i - 1)}, value, true
+	}
+	return it
+}
+
+// Err is the error that ended the iteration, nil when it ran out of values
+func (it *Iterator) Err() *Error {
+	return it.err
+}
+
+// IteratorResult reads what a next method returns, {"value": v, "done": false}
+// for the next value or {"done": true} at the end, like a generator's next
+func IteratorResult(result Object) (Object, bool, *Error) {
+	hash, ok := result.(*Hash)
+	if !ok {
+		return nil, false, newError("next must return a HASH with value and done, got %s", result.Type())
+	}
+	done, ok := hash.Pairs[(&String{Value: "done"}).HashKey()]
+	if !ok {
+		return nil, false, newError("next must return a HASH with value and done, got %s", result.Inspect())
+	}
+	if b, ok := done.Value.(*Boolean); ok && b.Value {
+		return nil, true, nil
+	}
+	value, ok := hash.Pairs[(&String{Value: "value"}).HashKey()]
+	if !ok {
+		return nil, false, newError("next must return a HASH with value and done, got %s", result.Inspect())
+	}
+	return value.Value, false, nil
+}
+
+// the builtins taking collections: what they take as it is, and what
+// they collect any other iterable into. the set operations take sets
+// for every argument, the others take a collection first.
+// first needs one value, so it doesn't read an endless iterable to the end
+var collectingBuiltins = map[string]struct {
+	takes []ObjectType
+	into  ObjectType
+	// the number of values read, 0 for all of them
+	upTo int
+}{
+	"len":          {[]ObjectType{ARRAY_OBJ, STRING_OBJ, SET_OBJ, RANGE_OBJ}, ARRAY_OBJ, 0},
+	"first":        {[]ObjectType{ARRAY_OBJ}, ARRAY_OBJ, 1},
+	"last":         {[]ObjectType{ARRAY_OBJ}, ARRAY_OBJ, 0},
+	"rest":         {[]ObjectType{ARRAY_OBJ}, ARRAY_OBJ, 0},
+	"union":        {[]ObjectType{SET_OBJ}, SET_OBJ, 0},
+	"intersection": {[]ObjectType{SET_OBJ}, SET_OBJ, 0},
+	"difference":   {[]ObjectType{SET_OBJ}, SET_OBJ, 0},
+}
+
+// BindIterate makes the builtin b named name take any iterable in place of
+// a collection, collecting it with iterate first. other builtins are
+// returned as they are
+func BindIterate(name string, b *Builtin, iterate Iterate) *Builtin {
+	collecting, ok := collectingBuiltins[name]
+	if !ok {
+		return b
+	}
+	return &Builtin{Fn: func(args ...Object) Object {
+		// args may be a window on a stack, it's not changed in place
+		args = append([]Object{}, args...)
+		for i, arg := range args {
+			if i > 0 && collecting.into == ARRAY_OBJ {
+				break
+			}
+			if takes(collecting.takes, arg) {
+				continue
+			}
+			iterator, err := iterate(arg)
+			if err != nil {
+				// not iterable, b tells what it takes
+				continue
+			}
+			collected, err := collect(iterator, collecting.into, collecting.upTo)
+			if err != nil {
+				return err
+			}
+			args[i] = collected
+		}
+		return b.Fn(args...)
+	}}
+}
+
+func takes(types []ObjectType, obj Object) bool {
+	for _, t := range types {
+		if obj.Type() == t {
+			return true
+		}
+	}
+	return false
+}
+
+// the values of iterator in an array, or a set. the first upTo of them
+// when upTo isn't 0, the rest are left for the next reader
+func collect(iterator *Iterator, into ObjectType, upTo int) (Object, *Error) {
+	elements := []Object{}
+	for upTo == 0 || len(elements) < upTo {
+		value, ok := iterator.NextValue()
+		if !ok {
+			break
+		}
+		elements = append(elements, value)
+	}
+	err := iterator.Err()
+	if err != nil {
+		return nil, err
+	}
+	if into == ARRAY_OBJ {
+		return &Array{Elements: elements}, nil
+	}
+	set := NewSet()
+	for _, el := range elements {
+		err := set.Add(el)
+		if err != nil {
+			return nil, newError("%s", err)
+		}
+	}
+	return set, nil
+}
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"io"
+	"sort"
 	"strings"
+	"sync"
 
 	"sawyer.com/v9/src/monkey/ast"
 	"sawyer.com/v9/src/monkey/code"
@@ -12,6 +15,7 @@ import (
 
 const (
 	INTEGER_OBJ           = "INTEGER"
+	BIGINT_OBJ            = "BIGINT"
 	BOOLEAN_OBJ           = "BOOLEAN"
 	NULL_OBJ              = "NULL"
 	RETURN_VALUE_OBJ      = "RETURN_VALUE"
@@ -21,8 +25,24 @@ const (
 	BUILTIN_OBJ           = "BUILTIN"
 	ARRAY_OBJ             = "ARRAY"
 	HASH_OBJ              = "HASH"
+	SET_OBJ               = "SET"
+	RANGE_OBJ             = "RANGE"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
 	CLOSURE_OBJ           = "CLOSURE"
+	ITERATOR_OBJ          = "ITERATOR"
+	MODULE_OBJ            = "MODULE"
+	STRUCT_TYPE_OBJ       = "STRUCT_TYPE"
+	STRUCT_OBJ            = "STRUCT"
+	CLASS_OBJ             = "CLASS"
+	INSTANCE_OBJ          = "INSTANCE"
+	BOUND_METHOD_OBJ      = "BOUND_METHOD"
+	ENUM_OBJ              = "ENUM"
+	VARIANT_TYPE_OBJ      = "VARIANT_TYPE"
+	VARIANT_OBJ           = "VARIANT"
+	GENERATOR_OBJ         = "GENERATOR"
+	CHANNEL_OBJ           = "CHANNEL"
+	TASK_OBJ              = "TASK"
+	BOX_OBJ               = "BOX"
 )
 
 // one of the strings above
@@ -80,11 +100,21 @@ func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 // internal error is an object
 type Error struct {
 	Message string
+	// the value of a throw, nil for runtime errors
+	Thrown Object
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
+// what a catch gets for a runtime error, e.g. {"message": "..."}
+func ErrorValue(message string) *Hash {
+	key := &String{Value: "message"}
+	return &Hash{Pairs: map[HashKey]HashPair{
+		key.HashKey(): {Key: key, Value: &String{Value: message}},
+	}}
+}
+
 // Environment is just a hash map
 // func NewEnvironment() *Environment {
 // 	s := make(map[string]Object)
@@ -109,6 +139,8 @@ type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment // for closure implementation
+	Generator  bool         // calling it makes a generator
+	Defers     bool         // its body has a defer statement
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -127,10 +159,13 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
-// Environment is a hash map
+// Environment is a hash map.
+// it's locked, spawned tasks read it while the program goes on defining names
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	mu     sync.RWMutex
+	store  map[string]Object
+	consts map[string]bool // names bound by const in this environment
+	outer  *Environment
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
@@ -141,11 +176,14 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	c := make(map[string]bool)
+	return &Environment{store: s, consts: c, outer: nil}
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
+	e.mu.RLock()
 	obj, ok := e.store[name]
+	e.mu.RUnlock()
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
 	}
@@ -153,10 +191,35 @@ func (e *Environment) Get(name string) (Object, bool) {
 }
 
 func (e *Environment) Set(name string, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	e.store[name] = val
 	return val
 }
 
+func (e *Environment) SetConst(name string, val Object) Object {
+	e.mu.Lock()
+	e.consts[name] = true
+	e.mu.Unlock()
+	return e.Set(name, val)
+}
+
+// the environment of the program or module e is enclosed by
+func (e *Environment) Outermost() *Environment {
+	for e.outer != nil {
+		e = e.outer
+	}
+	return e
+}
+
+// whether name is a const of this very environment,
+// redefining it in an enclosed environment just shadows it
+func (e *Environment) IsConst(name string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.consts[name]
+}
+
 // string is an object
 type String struct {
 	Value string
@@ -252,12 +315,139 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// pairs sorted by key, so iterating over a hash is deterministic.
+// integers and strings are ordered by value, false comes before true,
+// keys of different types are grouped by type
+func (h *Hash) OrderedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return lessKey(pairs[i].Key, pairs[j].Key)
+	})
+	return pairs
+}
+
+func lessKey(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *BigInt:
+		return a.Value.Cmp(b.(*BigInt).Value) < 0
+	case *String:
+		return a.Value < b.(*String).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	default:
+		return a.Inspect() < b.Inspect()
+	}
+}
+
+// Iterator is an object, it walks over an array, a hash, a set, a range or a string.
+// it's what comprehensions loop over
+type Iterator struct {
+	// returns the index (or key) and the element (or value),
+	// false when exhausted
+	next func() (Object, Object, bool)
+	// a single loop variable gets the key instead of the value, like for hashes
+	keys bool
+	// what ended the iteration early, see NewStepIterator
+	err *Error
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "iterator" }
+
+// for k, v in ...
+func (it *Iterator) Next() (Object, Object, bool) {
+	return it.next()
+}
+
+// for x in ..., elements of arrays and strings, keys of hashes
+func (it *Iterator) NextValue() (Object, bool) {
+	key, value, ok := it.next()
+	if it.keys {
+		return key, ok
+	}
+	return value, ok
+}
+
+// returns false when obj is not iterable
+func NewIterator(obj Object) (*Iterator, bool) {
+	i := 0
+	switch obj := obj.(type) {
+	case *Iterator:
+		return obj, true
+	case *Array:
+		// the length is checked on every step, so appended elements are seen
+		return &Iterator{next: func() (Object, Object, bool) {
+			if i >= len(obj.Elements) {
+				return nil, nil, false
+			}
+			i++
+			return &Integer{Value: int64(i - 1)}, obj.Elements[i-1], true
+		}}, true
+	case *String:
+		return &Iterator{next: func() (Object, Object, bool) {
+			if i >= len(obj.Value) {
+				return nil, nil, false
+			}
+			i++
+			return &Integer{Value: int64(i - 1)}, &String{Value: obj.Value[i-1 : i]}, true
+		}}, true
+	case *Range:
+		return &Iterator{next: func() (Object, Object, bool) {
+			value, ok := obj.At(int64(i))
+			if !ok {
+				return nil, nil, false
+			}
+			i++
+			return &Integer{Value: int64(i - 1)}, value, true
+		}}, true
+	case *Set:
+		// a snapshot like for hashes, indexed like an array
+		elements := obj.OrderedElements()
+		return &Iterator{next: func() (Object, Object, bool) {
+			if i >= len(elements) {
+				return nil, nil, false
+			}
+			i++
+			return &Integer{Value: int64(i - 1)}, elements[i-1], true
+		}}, true
+	case *Hash:
+		// a snapshot, changing the hash while iterating doesn't affect it
+		pairs := obj.OrderedPairs()
+		return &Iterator{keys: true, next: func() (Object, Object, bool) {
+			if i >= len(pairs) {
+				return nil, nil, false
+			}
+			i++
+			return pairs[i-1].Key, pairs[i-1].Value, true
+		}}, true
+	default:
+		return nil, false
+	}
+}
+
 // CompiledFunction is an object
 type CompiledFunction struct {
 	Instructions  code.Instructions
     // NumLocals = len(parameters) + len(locals)
 	NumLocals     int // indicate how many local bindings this function is going to create
 	NumParameters int
+	// the parameters' names, for keyword arguments
+	Parameters []string
+	// pipeline stages by the position of their call, for runtime errors
+	Stages map[int]string
+	// the module the function was compiled in, nil for the main program.
+	// it runs with the module's constants and globals wherever it's called
+	Module *Module
+	// calling it makes a generator
+	Generator bool
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -265,15 +455,454 @@ func (cf *CompiledFunction) Inspect() string {
 	return fmt.Sprintf("CompiledFunction[%p]", cf)
 }
 
+// BindKeywords orders the arguments of a call like params. args are the
+// positional arguments followed by the values of the keyword arguments named
+// by keywords. the names are checked before the count, so a wrong name is
+// reported as one even when there are too many arguments as well
+func BindKeywords(params []string, args []Object, keywords []string) ([]Object, error) {
+	positional := len(args) - len(keywords)
+	indices := make([]int, len(keywords))
+	for i, name := range keywords {
+		j := indexOf(params, name)
+		if j < 0 {
+			return nil, fmt.Errorf("unexpected keyword argument %s", name)
+		}
+		if j < positional || indexOf(keywords[:i], name) >= 0 {
+			return nil, fmt.Errorf("duplicate argument %s", name)
+		}
+		indices[i] = j
+	}
+	if len(args) > len(params) {
+		return nil, fmt.Errorf("wrong number of arguments: want=%d, got=%d", len(params), len(args))
+	}
+	bound := make([]Object, len(params))
+	copy(bound, args[:positional])
+	for i, j := range indices {
+		bound[j] = args[positional+i]
+	}
+	for i, arg := range bound {
+		if arg == nil {
+			return nil, fmt.Errorf("missing argument %s", params[i])
+		}
+	}
+	return bound, nil
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
 // Closure is an object
 // Treat every function as a closure
 // Closure: function literal + function's free variables
 type Closure struct {
 	Fn   *CompiledFunction
 	Free []Object // variables not belong to fn
+	// the class a method belongs to, set when the class is made
+	Class *Class
 }
 
 func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
 func (c *Closure) Inspect() string {
 	return fmt.Sprintf("Closure[%p]", c)
 }
+
+// Box is what a closure captures of a local whose let is still running,
+// let h = {"f": fn() { h.x }}. the let fills it with the value once it has
+// it, and OpGetFree reads through it
+type Box struct {
+	Value Object
+}
+
+func (b *Box) Type() ObjectType { return BOX_OBJ }
+func (b *Box) Inspect() string  { return "Box" }
+
+// Module is an object, what import binds to its name
+type Module struct {
+	Name    string // the path it was imported by
+	Exports map[string]Object
+	// compiled modules only, the namespace their functions run in
+	Constants []Object
+	Globals   []Object
+	// and the compiler's symbol table of the globals, for eval.
+	// a *compiler.SymbolTable, which can't be named here
+	SymbolTable interface{}
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return fmt.Sprintf("Module[%s]", m.Name) }
+
+// StructType is an object, what a struct declaration binds its name to.
+// calling it constructs a Struct, with the arguments in field order
+type StructType struct {
+	Name    string
+	Fields  []string
+	Offsets map[string]int // field name to its index in Struct.Fields
+}
+
+func NewStructType(name string, fields []string) *StructType {
+	offsets := make(map[string]int, len(fields))
+	for i, field := range fields {
+		offsets[field] = i
+	}
+	return &StructType{Name: name, Fields: fields, Offsets: offsets}
+}
+
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJ }
+func (st *StructType) Inspect() string {
+	return fmt.Sprintf("struct %s { %s }", st.Name, strings.Join(st.Fields, ", "))
+}
+
+// two declarations of the same struct, e.g. from calling a function twice
+func (st *StructType) sameLayout(other *StructType) bool {
+	if st == other {
+		return true
+	}
+	if st.Name != other.Name || len(st.Fields) != len(other.Fields) {
+		return false
+	}
+	for i, field := range st.Fields {
+		if other.Fields[i] != field {
+			return false
+		}
+	}
+	return true
+}
+
+// Struct is an object, its fields are stored in declaration order
+type Struct struct {
+	StructType *StructType
+	Fields     []Object
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+func (s *Struct) Inspect() string {
+	var out bytes.Buffer
+	out.WriteString(s.StructType.Name + "{")
+	for i, name := range s.StructType.Fields {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(name + ": " + s.Fields[i].Inspect())
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// a field by name, false if the struct has no such field
+func (s *Struct) Get(name string) (Object, bool) {
+	offset, ok := s.StructType.Offsets[name]
+	if !ok {
+		return nil, false
+	}
+	return s.Fields[offset], true
+}
+
+func (s *Struct) Set(name string, value Object) bool {
+	offset, ok := s.StructType.Offsets[name]
+	if ok {
+		s.Fields[offset] = value
+	}
+	return ok
+}
+
+// structural equality: same struct type and equal fields. integers and strings
+// compare by value, nested structs recursively, anything else by identity
+func (s *Struct) Equal(other *Struct) bool {
+	if s == other {
+		return true
+	}
+	if !s.StructType.sameLayout(other.StructType) {
+		return false
+	}
+	for i, field := range s.Fields {
+		if !fieldsEqual(field, other.Fields[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func fieldsEqual(a, b Object) bool {
+	switch a := a.(type) {
+	case *Variant:
+		b, ok := b.(*Variant)
+		return ok && a.Equal(b)
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *BigInt:
+		b, ok := b.(*BigInt)
+		return ok && a.Value.Cmp(b.Value) == 0
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Struct:
+		b, ok := b.(*Struct)
+		return ok && a.Equal(b)
+	}
+	return a == b
+}
+
+// Class is an object, what a class declaration binds its name to.
+// calling it makes an Instance and runs init on it
+type Class struct {
+	Name    string
+	Super   *Class            // nil without extends
+	Methods map[string]Object // a Closure in the vm, a Function in the evaluator
+}
+
+func (c *Class) Type() ObjectType { return CLASS_OBJ }
+func (c *Class) Inspect() string {
+	if c.Super != nil {
+		return "class " + c.Name + " extends " + c.Super.Name
+	}
+	return "class " + c.Name
+}
+
+// a method by name, looked up along the superclasses
+func (c *Class) Lookup(name string) (Object, bool) {
+	for class := c; class != nil; class = class.Super {
+		if method, ok := class.Methods[name]; ok {
+			return method, true
+		}
+	}
+	return nil, false
+}
+
+// Instance is an object, made by calling a Class. its fields are set through self
+type Instance struct {
+	Class  *Class
+	Fields map[string]Object
+}
+
+func NewInstance(class *Class) *Instance {
+	return &Instance{Class: class, Fields: make(map[string]Object)}
+}
+
+func (i *Instance) Type() ObjectType { return INSTANCE_OBJ }
+func (i *Instance) Inspect() string {
+	names := make([]string, 0, len(i.Fields))
+	for name := range i.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := []string{}
+	for _, name := range names {
+		fields = append(fields, name+": "+i.Fields[name].Inspect())
+	}
+	return i.Class.Name + "{" + strings.Join(fields, ", ") + "}"
+}
+
+// a field, or else a method bound to the instance
+func (i *Instance) Get(name string) (Object, bool) {
+	if value, ok := i.Fields[name]; ok {
+		return value, true
+	}
+	if method, ok := i.Class.Lookup(name); ok {
+		return &BoundMethod{Receiver: i, Method: method, Name: name}, true
+	}
+	return nil, false
+}
+
+// BoundMethod is an object, a method together with the instance it's called on
+type BoundMethod struct {
+	Receiver *Instance
+	Method   Object
+	Name     string
+}
+
+func (bm *BoundMethod) Type() ObjectType { return BOUND_METHOD_OBJ }
+func (bm *BoundMethod) Inspect() string {
+	return "bound method " + bm.Receiver.Class.Name + "." + bm.Name
+}
+
+// Enum is an object, what an enum declaration binds its name to.
+// its variants are read as members, Status.Pending
+type Enum struct {
+	Name     string
+	Variants []*VariantType
+}
+
+func NewEnum(name string) *Enum {
+	return &Enum{Name: name}
+}
+
+// add a variant, a variant without fields has a single value made right away
+func (e *Enum) AddVariant(name string, fields []string) {
+	vt := &VariantType{Enum: e, Name: name, Fields: fields}
+	if len(fields) == 0 {
+		vt.Value = &Variant{VariantType: vt}
+	}
+	e.Variants = append(e.Variants, vt)
+}
+
+// Status.Pending is the variant itself, Status.Done the constructor of its variants
+func (e *Enum) Member(name string) (Object, bool) {
+	for _, vt := range e.Variants {
+		if vt.Name == name {
+			if vt.Value != nil {
+				return vt.Value, true
+			}
+			return vt, true
+		}
+	}
+	return nil, false
+}
+
+func (e *Enum) Type() ObjectType { return ENUM_OBJ }
+func (e *Enum) Inspect() string {
+	variants := []string{}
+	for _, vt := range e.Variants {
+		if vt.Value != nil {
+			variants = append(variants, vt.Name)
+		} else {
+			variants = append(variants, vt.Name+"("+strings.Join(vt.Fields, ", ")+")")
+		}
+	}
+	return fmt.Sprintf("enum %s { %s }", e.Name, strings.Join(variants, ", "))
+}
+
+// VariantType is an object, a variant with fields. calling it makes a Variant
+type VariantType struct {
+	Enum   *Enum
+	Name   string
+	Fields []string
+	Value  *Variant // the only value of a variant without fields
+}
+
+func (vt *VariantType) Type() ObjectType { return VARIANT_TYPE_OBJ }
+func (vt *VariantType) Inspect() string  { return vt.Enum.Name + "." + vt.Name }
+
+// Variant is an object, a value of an enum
+type Variant struct {
+	VariantType *VariantType
+	Values      []Object
+}
+
+func (v *Variant) Type() ObjectType { return VARIANT_OBJ }
+func (v *Variant) Inspect() string {
+	if len(v.Values) == 0 {
+		return v.VariantType.Inspect()
+	}
+	values := []string{}
+	for _, value := range v.Values {
+		values = append(values, value.Inspect())
+	}
+	return v.VariantType.Inspect() + "(" + strings.Join(values, ", ") + ")"
+}
+
+// a field by name, false if the variant has no such field
+func (v *Variant) Get(name string) (Object, bool) {
+	for i, field := range v.VariantType.Fields {
+		if field == name {
+			return v.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+// variants are equal when they're the same variant of the same enum and
+// their values are equal, compared like the fields of a struct
+func (v *Variant) Equal(other *Variant) bool {
+	if v == other {
+		return true
+	}
+	if v.VariantType.Name != other.VariantType.Name ||
+		v.VariantType.Enum.Name != other.VariantType.Enum.Name ||
+		len(v.Values) != len(other.Values) {
+		return false
+	}
+	for i, value := range v.Values {
+		if !fieldsEqual(value, other.Values[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// equal variants have equal hash keys. hashable values and structs are
+// hashed by value, anything else by identity, like Equal compares them
+func (v *Variant) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(v.VariantType.Inspect()))
+	for _, value := range v.Values {
+		hashValue(h, value)
+	}
+	return HashKey{Type: v.Type(), Value: h.Sum64()}
+}
+
+func hashValue(h io.Writer, value Object) {
+	switch value := value.(type) {
+	case Hashable:
+		key := value.HashKey()
+		fmt.Fprintf(h, "|%s:%d", key.Type, key.Value)
+	case *Struct:
+		fmt.Fprintf(h, "|%s{", value.StructType.Name)
+		for _, field := range value.Fields {
+			hashValue(h, field)
+		}
+		fmt.Fprint(h, "}")
+	default:
+		fmt.Fprintf(h, "|%p", value)
+	}
+}
+
+// Generator is an object, what calling a function that yields returns.
+// nothing of the function runs before the first resume
+type Generator struct {
+	// runs the function up to its next yield and returns the yielded value,
+	// or what the function returned and done. sent is what the paused yield
+	// evaluates to. a runtime error comes back as an *Error, and ends it
+	Resume func(sent Object) (value Object, done bool)
+	// ends it without running the rest of the function. false if it's
+	// running, which it can't be ended from
+	Close func() bool
+}
+
+func (g *Generator) Type() ObjectType { return GENERATOR_OBJ }
+func (g *Generator) Inspect() string  { return "Generator" }
+
+// Channel is an object, a go channel of objects. channel(n) makes one
+type Channel struct {
+	Ch chan Object
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return fmt.Sprintf("Channel(%d)", cap(c.Ch)) }
+
+// Task is an object, a function spawned to run concurrently
+type Task struct {
+	done   chan struct{}
+	result Object
+}
+
+func NewTask() *Task {
+	return &Task{done: make(chan struct{})}
+}
+
+func (t *Task) Type() ObjectType { return TASK_OBJ }
+func (t *Task) Inspect() string  { return "Task" }
+
+// called once, with what the function returned or the *Error it failed with
+func (t *Task) Finish(result Object) {
+	t.result = result
+	close(t.done)
+}
+
+// task.await() waits for the function to finish and returns its result.
+// a task that failed fails the await with the same error
+func (t *Task) AwaitMethod() *Builtin {
+	return &Builtin{Fn: func(args ...Object) Object {
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0", len(args))
+		}
+		<-t.done
+		return t.result
+	}}
+}
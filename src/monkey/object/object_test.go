@@ -2,6 +2,7 @@ package object
 
 import (
 	"fmt"
+	"math/big"
 	"testing"
 )
 
@@ -43,3 +44,84 @@ func TestStringHashKey(t *testing.T) {
 	// => (name1.HashKey() == name2.HashKey())=true
 
 }
+
+func TestBigIntHashKey(t *testing.T) {
+	a, _ := new(big.Int).SetString("100000000000000000000", 10)
+	b, _ := new(big.Int).SetString("100000000000000000000", 10)
+	big1 := &BigInt{Value: a}
+	big2 := &BigInt{Value: b}
+	neg := &BigInt{Value: new(big.Int).Neg(a)}
+	if big1.HashKey() != big2.HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+	if big1.HashKey() == neg.HashKey() {
+		t.Errorf("big integers with different signs have same hash keys")
+	}
+	if _, ok := NewInteger(big.NewInt(5)).(*Integer); !ok {
+		t.Errorf("NewInteger of a small value is not an Integer")
+	}
+}
+
+func TestStructInspect(t *testing.T) {
+	point := NewStructType("Point", []string{"x", "y"})
+	if point.Inspect() != "struct Point { x, y }" {
+		t.Errorf("wrong struct type Inspect. got=%q", point.Inspect())
+	}
+	p := &Struct{StructType: point, Fields: []Object{&Integer{Value: 1}, &String{Value: "a"}}}
+	if p.Inspect() != "Point{x: 1, y: a}" {
+		t.Errorf("wrong struct Inspect. got=%q", p.Inspect())
+	}
+	if point.Offsets["y"] != 1 {
+		t.Errorf("wrong offset for y. got=%d", point.Offsets["y"])
+	}
+}
+
+func TestClassLookup(t *testing.T) {
+	speak := &String{Value: "speak"}
+	animal := &Class{Name: "Animal", Methods: map[string]Object{"speak": speak}}
+	dog := &Class{Name: "Dog", Super: animal, Methods: map[string]Object{}}
+	if method, ok := dog.Lookup("speak"); !ok || method != speak {
+		t.Errorf("expected speak to be found on the superclass, got=%v", method)
+	}
+	if _, ok := dog.Lookup("fetch"); ok {
+		t.Errorf("expected fetch not to be found")
+	}
+	if dog.Inspect() != "class Dog extends Animal" {
+		t.Errorf("wrong class Inspect. got=%q", dog.Inspect())
+	}
+
+	rex := NewInstance(dog)
+	rex.Fields["name"] = &String{Value: "rex"}
+	rex.Fields["age"] = &Integer{Value: 3}
+	if rex.Inspect() != "Dog{age: 3, name: rex}" {
+		t.Errorf("wrong instance Inspect. got=%q", rex.Inspect())
+	}
+	bound, ok := rex.Get("speak")
+	if !ok || bound.Inspect() != "bound method Dog.speak" {
+		t.Errorf("expected a bound method, got=%v", bound)
+	}
+}
+
+func TestVariantHashKey(t *testing.T) {
+	status := NewEnum("Status")
+	status.AddVariant("Pending", []string{})
+	status.AddVariant("Done", []string{"result"})
+	done, _ := status.Member("Done")
+	vt := done.(*VariantType)
+	one1 := &Variant{VariantType: vt, Values: []Object{&Integer{Value: 1}}}
+	one2 := &Variant{VariantType: vt, Values: []Object{&Integer{Value: 1}}}
+	two := &Variant{VariantType: vt, Values: []Object{&Integer{Value: 2}}}
+	if one1.HashKey() != one2.HashKey() {
+		t.Errorf("equal variants have different hash keys")
+	}
+	if one1.HashKey() == two.HashKey() {
+		t.Errorf("different variants have the same hash key")
+	}
+	pending, _ := status.Member("Pending")
+	if pending.Inspect() != "Status.Pending" || one1.Inspect() != "Status.Done(1)" {
+		t.Errorf("wrong Inspect. got=%q, %q", pending.Inspect(), one1.Inspect())
+	}
+	if status.Inspect() != "enum Status { Pending, Done(result) }" {
+		t.Errorf("wrong enum Inspect. got=%q", status.Inspect())
+	}
+}
@@ -0,0 +1,199 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Range is an object, the integers from Start up to End by Step.
+// it's lazy, the integers are computed when they're needed
+type Range struct {
+	Start, End, Step int64
+	// End is part of the range, a..=b
+	Inclusive bool
+}
+
+// NewRange checks the bounds and the step of start..end step step,
+// step is nil when it's left out
+func NewRange(start, end, step Object, inclusive bool) (*Range, error) {
+	values := []int64{0, 0, 1}
+	for i, bound := range []Object{start, end, step} {
+		if bound == nil {
+			continue
+		}
+		integer, ok := bound.(*Integer)
+		if !ok {
+			return nil, fmt.Errorf("range bounds must be INTEGER, got %s", bound.Type())
+		}
+		values[i] = integer.Value
+	}
+	if values[2] == 0 {
+		return nil, fmt.Errorf("range step must not be 0")
+	}
+	return &Range{Start: values[0], End: values[1], Step: values[2], Inclusive: inclusive}, nil
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	var out strings.Builder
+	op := ".."
+	if r.Inclusive {
+		op = "..="
+	}
+	fmt.Fprintf(&out, "%d%s%d", r.Start, op, r.End)
+	if r.Step != 1 {
+		fmt.Fprintf(&out, " step %d", r.Step)
+	}
+	return out.String()
+}
+
+// the index of the last integer of the range and the size of the step,
+// false when it's empty. a range of int64s can have 2^64 integers, too many
+// for an int64 or even a uint64, but its last index always fits a uint64
+func (r *Range) last() (last, step uint64, ok bool) {
+	var distance uint64
+	if r.Step > 0 {
+		if r.End < r.Start || r.End == r.Start && !r.Inclusive {
+			return 0, 0, false
+		}
+		distance, step = uint64(r.End)-uint64(r.Start), uint64(r.Step)
+	} else {
+		if r.End > r.Start || r.End == r.Start && !r.Inclusive {
+			return 0, 0, false
+		}
+		// -r.Step wraps for the smallest int64, the uint64 is right anyway
+		distance, step = uint64(r.Start)-uint64(r.End), uint64(-r.Step)
+	}
+	if !r.Inclusive {
+		distance--
+	}
+	return distance / step, step, true
+}
+
+// Len is the number of integers in the range, false when it's more than
+// an int64 holds
+func (r *Range) Len() (int64, bool) {
+	last, _, ok := r.last()
+	if !ok {
+		return 0, true
+	}
+	if last >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(last) + 1, true
+}
+
+// At is the i-th integer of the range, negative i counts from the end.
+// false when i is out of range
+func (r *Range) At(i int64) (Object, bool) {
+	last, _, ok := r.last()
+	if !ok {
+		return nil, false
+	}
+	var k uint64
+	if i >= 0 {
+		k = uint64(i)
+		if k > last {
+			return nil, false
+		}
+	} else {
+		// -1 is the last one, fromEnd is 0 for it
+		fromEnd := uint64(-(i + 1))
+		if fromEnd > last {
+			return nil, false
+		}
+		k = last - fromEnd
+	}
+	// it's in the range, so it's an int64 even if the product wraps on the way
+	return &Integer{Value: int64(uint64(r.Start) + k*uint64(r.Step))}, true
+}
+
+// Has tells whether n is one of the integers of the range
+func (r *Range) Has(n int64) bool {
+	last, step, ok := r.last()
+	if !ok {
+		return false
+	}
+	var distance uint64
+	if r.Step > 0 {
+		if n < r.Start {
+			return false
+		}
+		distance = uint64(n) - uint64(r.Start)
+	} else {
+		if n > r.Start {
+			return false
+		}
+		distance = uint64(r.Start) - uint64(n)
+	}
+	return distance%step == 0 && distance/step <= last
+}
+
+// the indices of a sequence of length that r selects as a slice bound.
+// like the bounds of a slice, negative bounds count from the end and
+// bounds out of range are clamped
+func (r *Range) indices(length int64) []int64 {
+	resolve := func(i int64) int64 {
+		if i < 0 {
+			i += length
+		}
+		return i
+	}
+	clamp := func(i, low, high int64) int64 {
+		if i < low {
+			return low
+		}
+		if i > high {
+			return high
+		}
+		return i
+	}
+	indices := []int64{}
+	if r.Step > 0 {
+		low, high := resolve(r.Start), resolve(r.End)
+		// past the end already, one more would overflow at the largest int64
+		if r.Inclusive && high < length {
+			high++
+		}
+		low, high = clamp(low, 0, length), clamp(high, 0, length)
+		for i := low; i < high; i += r.Step {
+			indices = append(indices, i)
+			if r.Step >= high-i {
+				break
+			}
+		}
+		return indices
+	}
+	// counting down, -1 is before the first element
+	high, low := resolve(r.Start), resolve(r.End)
+	if r.Inclusive && low >= 0 {
+		low--
+	}
+	high, low = clamp(high, -1, length-1), clamp(low, -1, length-1)
+	for i := high; i > low; i += r.Step {
+		indices = append(indices, i)
+	}
+	return indices
+}
+
+// Select is the elements of an array or the characters of a string at the
+// indices r selects, xs[1..3] is xs[1:3] and xs[0..n step 2] every other one
+func Select(collection Object, r *Range) (Object, error) {
+	switch collection := collection.(type) {
+	case *Array:
+		indices := r.indices(int64(len(collection.Elements)))
+		elements := make([]Object, len(indices))
+		for i, index := range indices {
+			elements[i] = collection.Elements[index]
+		}
+		return &Array{Elements: elements}, nil
+	case *String:
+		var out strings.Builder
+		for _, index := range r.indices(int64(len(collection.Value))) {
+			out.WriteByte(collection.Value[index])
+		}
+		return &String{Value: out.String()}, nil
+	}
+	return nil, fmt.Errorf("index operator not supported: %s", collection.Type())
+}
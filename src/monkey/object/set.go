@@ -0,0 +1,137 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Set is an object, distinct values keyed like the keys of a Hash
+type Set struct {
+	Elements map[HashKey]Object
+}
+
+func NewSet() *Set {
+	return &Set{Elements: make(map[HashKey]Object)}
+}
+
+func (s *Set) Type() ObjectType { return SET_OBJ }
+func (s *Set) Inspect() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, el := range s.OrderedElements() {
+		elements = append(elements, el.Inspect())
+	}
+	out.WriteString("#{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// Add puts obj in the set, it has to be hashable
+func (s *Set) Add(obj Object) error {
+	key, ok := obj.(Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as set element: %s", obj.Type())
+	}
+	s.Elements[key.HashKey()] = obj
+	return nil
+}
+
+// elements sorted like the keys of Hash.OrderedPairs
+func (s *Set) OrderedElements() []Object {
+	elements := make([]Object, 0, len(s.Elements))
+	for _, el := range s.Elements {
+		elements = append(elements, el)
+	}
+	sort.Slice(elements, func(i, j int) bool {
+		return lessKey(elements[i], elements[j])
+	})
+	return elements
+}
+
+// sets are equal when they have the same elements
+func (s *Set) Equal(other *Set) bool {
+	if len(s.Elements) != len(other.Elements) {
+		return false
+	}
+	for k := range s.Elements {
+		if _, ok := other.Elements[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Union is the elements of a or b
+func Union(a, b *Set) *Set {
+	result := NewSet()
+	for k, el := range a.Elements {
+		result.Elements[k] = el
+	}
+	for k, el := range b.Elements {
+		result.Elements[k] = el
+	}
+	return result
+}
+
+// Intersection is the elements of a that are in b
+func Intersection(a, b *Set) *Set {
+	result := NewSet()
+	for k, el := range a.Elements {
+		if _, ok := b.Elements[k]; ok {
+			result.Elements[k] = el
+		}
+	}
+	return result
+}
+
+// Difference is the elements of a that aren't in b
+func Difference(a, b *Set) *Set {
+	result := NewSet()
+	for k, el := range a.Elements {
+		if _, ok := b.Elements[k]; !ok {
+			result.Elements[k] = el
+		}
+	}
+	return result
+}
+
+// Contains is value in collection: an element of a set, an array or a
+// range, a key of a hash, or a substring of a string
+func Contains(collection, value Object) (bool, error) {
+	switch collection := collection.(type) {
+	case *Set:
+		key, ok := value.(Hashable)
+		if !ok {
+			return false, fmt.Errorf("unusable as set element: %s", value.Type())
+		}
+		_, ok = collection.Elements[key.HashKey()]
+		return ok, nil
+	case *Hash:
+		key, ok := value.(Hashable)
+		if !ok {
+			return false, fmt.Errorf("unusable as hash key: %s", value.Type())
+		}
+		_, ok = collection.Pairs[key.HashKey()]
+		return ok, nil
+	case *Array:
+		for _, el := range collection.Elements {
+			if fieldsEqual(el, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case *Range:
+		integer, ok := value.(*Integer)
+		return ok && collection.Has(integer.Value), nil
+	case *String:
+		str, ok := value.(*String)
+		if !ok {
+			return false, fmt.Errorf("operator in not supported: %s in STRING", value.Type())
+		}
+		return strings.Contains(collection.Value, str.Value), nil
+	}
+	return false, fmt.Errorf("operator in not supported: %s in %s", value.Type(), collection.Type())
+}
@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 
 	"sawyer.com/v9/src/monkey/ast"
@@ -13,28 +15,37 @@ import (
 const (
 	// 0
 	_ int = iota
-	// 1-7 int
+	// 1-10 int
 	LOWEST
+	ASSIGN      // a[0] = x
+	PIPE        // x |> f()
 	EQUALS      // ==
 	LESSGREATER // > or <
+	RANGE       // 0..n
 	SUM         //+
 	PRODUCT     //*
 	PREFIX      //-Xor!X
 	CALL        // myFunction(X)
-	INDEX       // myArray[2], array indexing
+	INDEX       // myArray[2], array indexing, config.port
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:    ASSIGN,
+	token.PIPE:      PIPE,
+	token.EQ:        EQUALS,
+	token.NOT_EQ:    EQUALS,
+	token.LT:        LESSGREATER,
+	token.GT:        LESSGREATER,
+	token.IN:        LESSGREATER,
+	token.DOTDOT:    RANGE,
+	token.DOTDOT_EQ: RANGE,
+	token.PLUS:      SUM,
+	token.MINUS:     SUM,
+	token.SLASH:     PRODUCT,
+	token.ASTERISK:  PRODUCT,
+	token.LPAREN:    CALL,
+	token.LBRACKET:  INDEX,
+	token.DOT:       INDEX,
 }
 
 // The Pratt Parser
@@ -43,11 +54,24 @@ type (
 	infixParseFn  func(ast.Expression) ast.Expression
 )
 
+type pendingLet struct {
+	stmt  *ast.LetStatement
+	depth int
+}
+
 type Parser struct {
 	l         *lexer.Lexer
 	errors    []string
 	curToken  token.Token
 	peekToken token.Token
+	// how many blocks deep the current token is, 0 at the top level
+	depth int
+	// the function literals whose bodies are being parsed, the innermost is the last
+	functions []*ast.FunctionLiteral
+	// the yields parsed so far in the innermost one
+	yields int
+	// the lets whose values are being parsed, with how many functions deep each is
+	lets []pendingLet
 
 	// The Pratt Parser, associating parsing function with its token type
 	prefixParseFns map[token.TokenType]prefixParseFn
@@ -70,11 +94,15 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression) // parentheses is a prefix expression
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.SUPER, p.parseSuperExpression)
+	p.registerPrefix(token.YIELD, p.parseYieldExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)          // if expression is a prefix expression
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral) // function literal is a prefix expression
 	p.registerPrefix(token.STRING, p.parseStringLiteral)     // string literial is a prefix expression
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)    // array literal is a prefix expression
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)       // hash literal is a prefix expression
+	p.registerPrefix(token.SET_LBRACE, p.parseSetLiteral)
 
 	// infix expression parser
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
@@ -86,8 +114,14 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.IN, p.parseInfixExpression) // x in xs
+	p.registerInfix(token.DOTDOT, p.parseRangeExpression)
+	p.registerInfix(token.DOTDOT_EQ, p.parseRangeExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)    // function call is an infix expression
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression) // array indexing is an infix expression
+	p.registerInfix(token.DOT, p.parseMemberExpression)     // member access is an infix expression
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)  // assignment is an infix expression
+	p.registerInfix(token.PIPE, p.parsePipeExpression)      // pipeline is sugar for a call expression
 
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
@@ -133,11 +167,27 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
-// In Monkey language there're 3 Statements only
+// In Monkey language there're 3 Statements only, const is a let variant
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.DEFER:
+		return p.parseDeferStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.STRUCT:
+		return p.parseStructStatement()
+	case token.CLASS:
+		return p.parseClassStatement()
+	case token.ENUM:
+		return p.parseEnumStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
 	default:
@@ -162,28 +212,286 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	defer untrace(trace("parseLetStatement"))
-	stmt := &ast.LetStatement{Token: p.curToken}
+	stmt := &ast.LetStatement{Token: p.curToken, Const: p.curTokenIs(token.CONST)}
 	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	// let n: int = 1
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+		stmt.Type = p.parseType()
+		if stmt.Type == nil {
+			return nil
+		}
+	}
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
 	p.nextToken()
+	p.lets = append(p.lets, pendingLet{stmt: stmt, depth: len(p.functions)})
 	stmt.Value = p.parseExpression(LOWEST)
+	p.lets = p.lets[:len(p.lets)-1]
     // save function's name
 	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
 		fl.Name = stmt.Name.Value
+		// it refers to itself by its name, not the binding
+		stmt.Captured = false
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// export let x = 1; marks a top-level binding of a module
+func (p *Parser) parseExportStatement() ast.Statement {
+	defer untrace(trace("parseExportStatement"))
+	if p.depth > 0 {
+		p.errors = append(p.errors, "export is only allowed at the top level")
+		return nil
+	}
+	if !p.peekTokenIs(token.LET) && !p.peekTokenIs(token.CONST) {
+		p.errors = append(p.errors, fmt.Sprintf(
+			"expected let or const after export, got %s instead", p.peekToken.Type))
+		return nil
+	}
+	p.nextToken()
+	stmt := p.parseLetStatement()
+	if stmt == nil {
+		return nil
+	}
+	stmt.Export = true
+	return stmt
+}
+
+// import "lib/strings.monkey" as s;
+func (p *Parser) parseImportStatement() ast.Statement {
+	defer untrace(trace("parseImportStatement"))
+	stmt := &ast.ImportStatement{Token: p.curToken}
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = p.curToken.Literal
+	if !p.expectPeek(token.AS) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	defer untrace(trace("parseThrowStatement"))
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// defer f(x), only inside a function
+func (p *Parser) parseDeferStatement() ast.Statement {
+	defer untrace(trace("parseDeferStatement"))
+	stmt := &ast.DeferStatement{Token: p.curToken}
+	if len(p.functions) == 0 {
+		p.errors = append(p.errors, "defer outside of a function")
+		return nil
+	}
+	p.functions[len(p.functions)-1].Defers = true
+	p.nextToken()
+	exp := p.parseExpression(LOWEST)
+	if exp == nil {
+		return nil
 	}
+	call, ok := exp.(*ast.CallExpression)
+	if !ok {
+		p.errors = append(p.errors, fmt.Sprintf("defer needs a call, got %s", exp))
+		return nil
+	}
+	stmt.Call = call
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
 
+// for (x in xs) { ... }, for (k, v in h) { ... }
+func (p *Parser) parseForStatement() ast.Statement {
+	defer untrace(trace("parseForStatement"))
+	stmt := &ast.ForStatement{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.parseLoopHead(&stmt.ComprehensionClause) {
+		return nil
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
+	return stmt
+}
 
+// struct Point { x, y }
+func (p *Parser) parseStructStatement() ast.Statement {
+	defer untrace(trace("parseStructStatement"))
+	stmt := &ast.StructStatement{Token: p.curToken}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		field := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if seen[field.Value] {
+			p.errors = append(p.errors, fmt.Sprintf(
+				"duplicate field %s in struct %s", field.Value, stmt.Name.Value))
+			return nil
+		}
+		seen[field.Value] = true
+		stmt.Fields = append(stmt.Fields, field)
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
 	return stmt
 }
 
+// enum Status { Pending, Done(result), Failed(reason) }
+func (p *Parser) parseEnumStatement() ast.Statement {
+	defer untrace(trace("parseEnumStatement"))
+	stmt := &ast.EnumStatement{Token: p.curToken}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		variant := &ast.EnumVariant{Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+		if seen[variant.Name.Value] {
+			p.errors = append(p.errors, fmt.Sprintf(
+				"duplicate variant %s in enum %s", variant.Name.Value, stmt.Name.Value))
+			return nil
+		}
+		seen[variant.Name.Value] = true
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			variant.Fields = p.parseFunctionParameters()
+			if variant.Fields == nil {
+				return nil
+			}
+		}
+		stmt.Variants = append(stmt.Variants, variant)
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// class Name extends Super { method(params) { body } ... }
+func (p *Parser) parseClassStatement() ast.Statement {
+	defer untrace(trace("parseClassStatement"))
+	stmt := &ast.ClassStatement{Token: p.curToken}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.peekTokenIs(token.EXTENDS) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Super = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if seen[name.Value] {
+			p.errors = append(p.errors, fmt.Sprintf(
+				"duplicate method %s in class %s", name.Value, stmt.Name.Value))
+			return nil
+		}
+		seen[name.Value] = true
+		fn := &ast.FunctionLiteral{Token: p.curToken}
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		if !p.parseSignature(fn) {
+			return nil
+		}
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		fn.Body = p.parseFunctionBody(fn)
+		stmt.Methods = append(stmt.Methods, &ast.Method{Name: name, Function: fn})
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+	}
+	p.nextToken()
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseSuperExpression() ast.Expression {
+	defer untrace(trace("parseSuperExpression"))
+	exp := &ast.SuperExpression{Token: p.curToken}
+	if !p.expectPeek(token.DOT) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Method = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return exp
+}
+
 // The core of expression parsing logic
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	defer untrace(trace("parseExpression"))
@@ -235,9 +543,39 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// a..b, a..=b, then an optional step. step is only a keyword here,
+// it's an identifier everywhere else
+func (p *Parser) parseRangeExpression(start ast.Expression) ast.Expression {
+	defer untrace(trace("parseRangeExpression"))
+	expression := &ast.RangeExpression{
+		Token:     p.curToken,
+		Start:     start,
+		Inclusive: p.curTokenIs(token.DOTDOT_EQ),
+	}
+	p.nextToken()
+	expression.End = p.parseExpression(RANGE)
+	if p.peekTokenIs(token.IDENT) && p.peekToken.Literal == "step" {
+		p.nextToken()
+		p.nextToken()
+		expression.Step = p.parseExpression(RANGE)
+	}
+	return expression
+}
+
 func (p *Parser) parseIdentifier() ast.Expression {
 	defer untrace(trace("parseIdentifier"))
-	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	// a function in a let's value referring to the binding
+	for _, let := range p.lets {
+		if let.stmt.Name.Value == ident.Value && len(p.functions) > let.depth {
+			let.stmt.Captured = true
+		}
+	}
+	// x => x * 2
+	if p.peekTokenIs(token.ARROW) {
+		return p.parseArrowFunction(ident.Token, &ast.FunctionLiteral{Parameters: []*ast.Identifier{ident}})
+	}
+	return ident
 }
 
 func (p *Parser) curTokenIs(t token.TokenType) bool {
@@ -273,6 +611,13 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	defer untrace(trace("parseIntegerLiteral"))
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		// too big for an int64, it's a big integer
+		if n, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			lit.Big = n
+			return lit
+		}
+	}
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
 		p.errors = append(p.errors, msg)
@@ -309,6 +654,15 @@ func (p *Parser) parseBoolean() ast.Expression {
 // handle expression contains parentheses
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	defer untrace(trace("parseGroupedExpression"))
+	// (a, b) => a + b
+	if p.isArrowParameters() {
+		tok := p.curToken
+		lit := &ast.FunctionLiteral{}
+		if !p.parseSignature(lit) {
+			return nil
+		}
+		return p.parseArrowFunction(tok, lit)
+	}
 	p.nextToken()
 	exp := p.parseExpression(LOWEST)
 	if !p.expectPeek(token.RPAREN) {
@@ -346,9 +700,51 @@ func (p *Parser) parseIfExpression() ast.Expression {
 
 }
 
+// try { } catch (e) { } finally { }, catch (e) may leave out (e),
+// and one of catch and finally may be left out
+func (p *Parser) parseTryExpression() ast.Expression {
+	defer untrace(trace("parseTryExpression"))
+	expression := &ast.TryExpression{Token: p.curToken}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Block = p.parseBlockStatement()
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Catch = p.parseBlockStatement()
+	}
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Finally = p.parseBlockStatement()
+	}
+	if expression.Catch == nil && expression.Finally == nil {
+		p.errors = append(p.errors, "expected catch or finally after try block")
+		return nil
+	}
+	return expression
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
+	p.depth++
+	defer func() { p.depth-- }()
 	p.nextToken()
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
@@ -367,15 +763,143 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
-	lit.Parameters = p.parseFunctionParameters()
+	if !p.parseSignature(lit) {
+		return nil
+	}
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseFunctionBody(lit)
 
 	return lit
 }
 
+// the body of a function literal, a yield in it makes the function a generator
+func (p *Parser) parseFunctionBody(lit *ast.FunctionLiteral) *ast.BlockStatement {
+	p.functions = append(p.functions, lit)
+	yields := p.yields
+	defer func() {
+		p.functions = p.functions[:len(p.functions)-1]
+		p.yields = yields
+	}()
+	return p.parseBlockStatement()
+}
+
+// yield, yield x and yield* g, only inside a function
+func (p *Parser) parseYieldExpression() ast.Expression {
+	defer untrace(trace("parseYieldExpression"))
+	exp := &ast.YieldExpression{Token: p.curToken}
+	if len(p.functions) == 0 {
+		p.errors = append(p.errors, "yield outside of a function")
+		return nil
+	}
+	p.functions[len(p.functions)-1].Generator = true
+	p.yields++
+	if p.peekTokenIs(token.ASTERISK) {
+		p.nextToken()
+		exp.Delegate = true
+		p.nextToken()
+		exp.Value = p.parseExpression(LOWEST)
+		return exp
+	}
+	switch p.peekToken.Type {
+	case token.SEMICOLON, token.RPAREN, token.RBRACE, token.RBRACKET, token.COMMA, token.EOF:
+		return exp
+	}
+	p.nextToken()
+	exp.Value = p.parseExpression(LOWEST)
+	return exp
+}
+
+// called with the '(' as current token, tells a parameter list
+// followed by '=>' from a parenthesized expression. the parameters and
+// the result may be annotated like a function literal's, (x: int) -> int => x.
+// it scans ahead on a copy of the lexer, so nothing is consumed
+func (p *Parser) isArrowParameters() bool {
+	l := *p.l
+	tok := p.peekToken
+	if tok.Type != token.RPAREN {
+		for {
+			if tok.Type != token.IDENT {
+				return false
+			}
+			tok = l.NextToken()
+			if tok.Type == token.COLON {
+				tok = skipType(&l)
+			}
+			if tok.Type == token.RPAREN {
+				break
+			}
+			if tok.Type != token.COMMA {
+				return false
+			}
+			tok = l.NextToken()
+		}
+	}
+	tok = l.NextToken()
+	if tok.Type == token.THIN_ARROW {
+		tok = skipType(&l)
+	}
+	return tok.Type == token.ARROW
+}
+
+// skips the tokens of a type annotation and returns the one after it,
+// the first ',', ')' or '=>' that isn't nested in the type
+func skipType(l *lexer.Lexer) token.Token {
+	depth := 0
+	for {
+		tok := l.NextToken()
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			if depth == 0 {
+				return tok
+			}
+			depth--
+		case token.COMMA, token.ARROW:
+			if depth == 0 {
+				return tok
+			}
+		case token.EOF:
+			return tok
+		}
+	}
+}
+
+// called with the last token of the parameters as current token, the '=>' is next.
+// lit has the parameters and their annotations already. the body is either a block or a single expression, which becomes
+// the block's only statement so it's returned implicitly
+func (p *Parser) parseArrowFunction(start token.Token, lit *ast.FunctionLiteral) ast.Expression {
+	defer untrace(trace("parseArrowFunction"))
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+	// it's an ordinary function literal from here on
+	fnToken := token.Token{Type: token.FUNCTION, Literal: "fn",
+		Line: start.Line, Column: start.Column}
+	lit.Token = fnToken
+	if p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		lit.Body = p.parseFunctionBody(lit)
+		return lit
+	}
+	p.nextToken()
+	body := &ast.BlockStatement{Token: p.curToken}
+	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	p.functions = append(p.functions, lit)
+	yields := p.yields
+	stmt.Expression = p.parseExpression(LOWEST)
+	p.functions = p.functions[:len(p.functions)-1]
+	p.yields = yields
+	if stmt.Expression == nil {
+		return nil
+	}
+	body.Statements = []ast.Statement{stmt}
+	lit.Body = body
+	return lit
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 	if p.peekTokenIs(token.RPAREN) {
@@ -399,14 +923,178 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	return identifiers
 }
 
+// the parameters of a function literal, each maybe annotated, and the
+// annotation of its result, (x: int, ys) -> bool. the '(' is the current token
+func (p *Parser) parseSignature(lit *ast.FunctionLiteral) bool {
+	lit.Parameters = []*ast.Identifier{}
+	for !p.peekTokenIs(token.RPAREN) {
+		if len(lit.Parameters) > 0 && !p.expectPeek(token.COMMA) {
+			return false
+		}
+		if !p.expectPeek(token.IDENT) {
+			return false
+		}
+		lit.Parameters = append(lit.Parameters, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		if !p.peekTokenIs(token.COLON) {
+			continue
+		}
+		p.nextToken()
+		p.nextToken()
+		t := p.parseType()
+		if t == nil {
+			return false
+		}
+		for len(lit.ParameterTypes) < len(lit.Parameters)-1 {
+			lit.ParameterTypes = append(lit.ParameterTypes, nil)
+		}
+		lit.ParameterTypes = append(lit.ParameterTypes, t)
+	}
+	p.nextToken()
+	if p.peekTokenIs(token.THIN_ARROW) {
+		p.nextToken()
+		p.nextToken()
+		lit.ReturnType = p.parseType()
+		if lit.ReturnType == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// a type annotation, int | [string], the current token is its first one
+func (p *Parser) parseType() ast.TypeExpression {
+	first := p.parseSingleType()
+	if first == nil || !p.peekTokenIs(token.BAR) {
+		return first
+	}
+	union := &ast.UnionType{Token: p.peekToken, Types: []ast.TypeExpression{first}}
+	for p.peekTokenIs(token.BAR) {
+		p.nextToken()
+		p.nextToken()
+		t := p.parseSingleType()
+		if t == nil {
+			return nil
+		}
+		union.Types = append(union.Types, t)
+	}
+	return union
+}
+
+func (p *Parser) parseSingleType() ast.TypeExpression {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return &ast.NamedType{Token: p.curToken, Name: p.curToken.Literal}
+	case token.LBRACKET:
+		t := &ast.ArrayType{Token: p.curToken}
+		p.nextToken()
+		t.Element = p.parseType()
+		if t.Element == nil || !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		return t
+	case token.LBRACE:
+		t := &ast.HashType{Token: p.curToken}
+		p.nextToken()
+		t.Key = p.parseType()
+		if t.Key == nil || !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		t.Value = p.parseType()
+		if t.Value == nil || !p.expectPeek(token.RBRACE) {
+			return nil
+		}
+		return t
+	case token.FUNCTION:
+		t := &ast.FunctionType{Token: p.curToken, Parameters: []ast.TypeExpression{}}
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		for !p.peekTokenIs(token.RPAREN) {
+			if len(t.Parameters) > 0 && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+			p.nextToken()
+			param := p.parseType()
+			if param == nil {
+				return nil
+			}
+			t.Parameters = append(t.Parameters, param)
+		}
+		p.nextToken()
+		if p.peekTokenIs(token.THIN_ARROW) {
+			p.nextToken()
+			p.nextToken()
+			t.Return = p.parseType()
+			if t.Return == nil {
+				return nil
+			}
+		}
+		return t
+	case token.LPAREN:
+		// (fn(int) -> int) | null
+		p.nextToken()
+		t := p.parseType()
+		if t == nil || !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		return t
+	}
+	p.errors = append(p.errors, fmt.Sprintf("expected a type, got %s", p.curToken.Literal))
+	return nil
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	defer untrace(trace("parseCallExpression"))
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Arguments = p.parseCallArgumentList()
 
 	return exp
 }
 
+// like parseExpressionList, but arguments can be named: f(x, port: 80).
+// named ones come last
+func (p *Parser) parseCallArgumentList() []ast.Expression {
+	defer untrace(trace("parseCallArgumentList"))
+	args := []ast.Expression{}
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return args
+	}
+	keywords := false
+	for {
+		p.nextToken()
+		if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON) {
+			keywords = true
+			args = append(args, p.parseKeywordArgument())
+		} else {
+			if keywords {
+				p.errors = append(p.errors, "positional argument after keyword argument")
+				return nil
+			}
+			args = append(args, p.parseListElement())
+		}
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	return args
+}
+
+func (p *Parser) parseKeywordArgument() ast.Expression {
+	defer untrace(trace("parseKeywordArgument"))
+	arg := &ast.KeywordArgument{Token: p.curToken}
+	arg.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.nextToken()
+	p.nextToken()
+	arg.Value = p.parseExpression(LOWEST)
+	return arg
+}
+
 // substituted by function parseExpressionList
 func (p *Parser) parseCallArguments() []ast.Expression {
 	args := []ast.Expression{}
@@ -436,23 +1124,115 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	defer untrace(trace("parseArrayLiteral"))
 	array := &ast.ArrayLiteral{Token: p.curToken}
-	array.Elements = p.parseExpressionList(token.RBRACKET)
+	yields := p.yields
+	if p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		array.Elements = []ast.Expression{}
+		return array
+	}
+	p.nextToken()
+	first := p.parseListElement()
+	// [x * 2 for x in xs]
+	if _, ok := first.(*ast.SpreadElement); !ok && p.peekTokenIs(token.FOR) {
+		comprehension := &ast.ArrayComprehension{Token: array.Token, Element: first}
+		if !p.parseComprehensionClause(&comprehension.ComprehensionClause, yields) {
+			return nil
+		}
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		return comprehension
+	}
+	array.Elements = p.parseExpressionListFrom(first, token.RBRACKET)
 	return array
 }
 
+func (p *Parser) parseSetLiteral() ast.Expression {
+	defer untrace(trace("parseSetLiteral"))
+	set := &ast.SetLiteral{Token: p.curToken}
+	yields := p.yields
+	if p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		set.Elements = []ast.Expression{}
+		return set
+	}
+	p.nextToken()
+	first := p.parseListElement()
+	// #{x * 2 for x in xs}
+	if _, ok := first.(*ast.SpreadElement); !ok && p.peekTokenIs(token.FOR) {
+		comprehension := &ast.SetComprehension{Token: set.Token, Element: first}
+		if !p.parseComprehensionClause(&comprehension.ComprehensionClause, yields) {
+			return nil
+		}
+		if !p.expectPeek(token.RBRACE) {
+			return nil
+		}
+		return comprehension
+	}
+	set.Elements = p.parseExpressionListFrom(first, token.RBRACE)
+	return set
+}
+
+// called with the last token before 'for' as current token. yields is how
+// many yields the function had before the comprehension: a comprehension
+// runs as a function of its own, it can't yield for the enclosing one
+func (p *Parser) parseComprehensionClause(clause *ast.ComprehensionClause, yields int) bool {
+	defer untrace(trace("parseComprehensionClause"))
+	p.nextToken()
+	if !p.parseLoopHead(clause) {
+		return false
+	}
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		clause.Condition = p.parseExpression(LOWEST)
+	}
+	if p.yields > yields {
+		p.errors = append(p.errors, "yield inside a comprehension")
+		return false
+	}
+	return true
+}
+
+// x in xs or k, v in h, after the for of a comprehension or a for statement
+func (p *Parser) parseLoopHead(clause *ast.ComprehensionClause) bool {
+	if !p.expectPeek(token.IDENT) {
+		return false
+	}
+	clause.Variables = []*ast.Identifier{{Token: p.curToken, Value: p.curToken.Literal}}
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return false
+		}
+		clause.Variables = append(clause.Variables,
+			&ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+	if !p.expectPeek(token.IN) {
+		return false
+	}
+	p.nextToken()
+	clause.Iterable = p.parseExpression(LOWEST)
+	return clause.Iterable != nil
+}
+
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	defer untrace(trace("parseExpressionList"))
-	list := []ast.Expression{}
 	if p.peekTokenIs(end) {
 		p.nextToken()
-		return list
+		return []ast.Expression{}
 	}
 	p.nextToken()
-	list = append(list, p.parseExpression(LOWEST))
+	return p.parseExpressionListFrom(p.parseListElement(), end)
+}
+
+// the rest of a list whose first element is already parsed
+func (p *Parser) parseExpressionListFrom(first ast.Expression, end token.TokenType) []ast.Expression {
+	list := []ast.Expression{first}
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		list = append(list, p.parseExpression(LOWEST))
+		list = append(list, p.parseListElement())
 	}
 	if !p.expectPeek(end) {
 		return nil
@@ -460,30 +1240,136 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
+// an element of array literals and call arguments, which could be spread
+func (p *Parser) parseListElement() ast.Expression {
+	if p.curTokenIs(token.ELLIPSIS) {
+		return p.parseSpreadElement()
+	}
+	return p.parseExpression(LOWEST)
+}
+
+func (p *Parser) parseSpreadElement() ast.Expression {
+	defer untrace(trace("parseSpreadElement"))
+	spread := &ast.SpreadElement{Token: p.curToken}
+	p.nextToken()
+	spread.Value = p.parseExpression(LOWEST)
+	return spread
+}
+
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	defer untrace(trace("parseIndexExpression"))
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
 	p.nextToken()
+	// a[:end]
+	if p.curTokenIs(token.COLON) {
+		return p.parseSliceExpression(exp.Token, left, nil)
+	}
 	exp.Index = p.parseExpression(LOWEST)
+	// a[start:end]
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(exp.Token, left, exp.Index)
+	}
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return exp
+}
+
+// called with the ':' as current token
+func (p *Parser) parseSliceExpression(tok token.Token, left, start ast.Expression) ast.Expression {
+	defer untrace(trace("parseSliceExpression"))
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: start}
+	if p.peekTokenIs(token.RBRACKET) {
+		// a[start:]
+		p.nextToken()
+		return exp
+	}
+	p.nextToken()
+	exp.End = p.parseExpression(LOWEST)
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
 	return exp
 }
 
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	defer untrace(trace("parseMemberExpression"))
+	exp := &ast.MemberExpression{Token: p.curToken, Object: left}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Member = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return exp
+}
+
+// x |> f(a) is desugared to f(x, a), and x |> f to f(x)
+// the call keeps the |> token, so errors can point at the pipeline stage
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	defer untrace(trace("parsePipeExpression"))
+	tok := p.curToken
+	precedence := p.curPrecedence()
+	p.nextToken()
+	stage := p.parseExpression(precedence)
+	switch stage := stage.(type) {
+	case nil:
+		return nil
+	case *ast.CallExpression:
+		args := append([]ast.Expression{left}, stage.Arguments...)
+		return &ast.CallExpression{Token: tok, Function: stage.Function, Arguments: args}
+	default:
+		return &ast.CallExpression{Token: tok, Function: stage, Arguments: []ast.Expression{left}}
+	}
+}
+
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	defer untrace(trace("parseAssignExpression"))
+	exp := &ast.AssignExpression{Token: p.curToken, Target: target}
+	switch target.(type) {
+	case *ast.IndexExpression, *ast.MemberExpression:
+	default:
+		msg := fmt.Sprintf("invalid assignment target: %s", target)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	p.nextToken()
+	// right associative: a[0] = b[0] = 1
+	exp.Value = p.parseExpression(LOWEST)
+	return exp
+}
+
 func (p *Parser) parseHashLiteral() ast.Expression {
 	defer untrace(trace("parseHashLiterial"))
 	hash := &ast.HashLiteral{Token: p.curToken}
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
+	hash.Keys = []ast.Expression{}
+	yields := p.yields
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
-		key := p.parseExpression(LOWEST)
-		if !p.expectPeek(token.COLON) {
-			return nil
+		if p.curTokenIs(token.ELLIPSIS) {
+			// {...defaults}
+			hash.Keys = append(hash.Keys, p.parseSpreadElement())
+		} else {
+			key := p.parseExpression(LOWEST)
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+			p.nextToken()
+			value := p.parseExpression(LOWEST)
+			// {k: v for k, v in h}
+			if len(hash.Keys) == 0 && p.peekTokenIs(token.FOR) {
+				comprehension := &ast.HashComprehension{Token: hash.Token, Key: key, Value: value}
+				if !p.parseComprehensionClause(&comprehension.ComprehensionClause, yields) {
+					return nil
+				}
+				if !p.expectPeek(token.RBRACE) {
+					return nil
+				}
+				return comprehension
+			}
+			hash.Pairs[key] = value
+			hash.Keys = append(hash.Keys, key)
 		}
-		p.nextToken()
-		value := p.parseExpression(LOWEST)
-		hash.Pairs[key] = value
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
 		}
@@ -38,6 +38,76 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestConstStatements(t *testing.T) {
+	input := "const x = 5; let y = x;"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+	constStmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("s not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+	if !constStmt.Const || constStmt.Name.Value != "x" {
+		t.Errorf("expected const x, got=%q (const=%t)", constStmt.Name.Value, constStmt.Const)
+	}
+	if constStmt.String() != "const x = 5;" {
+		t.Errorf("constStmt.String() wrong. got=%q", constStmt.String())
+	}
+	letStmt := program.Statements[1].(*ast.LetStatement)
+	if letStmt.Const {
+		t.Errorf("let statement parsed as const")
+	}
+}
+
+func TestImportExportStatements(t *testing.T) {
+	input := `import "lib/strings.monkey" as s; export let x = 1; export const y = 2; let z = 3;`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 4 {
+		t.Fatalf("program.Statements does not contain 4 statements. got=%d",
+			len(program.Statements))
+	}
+	importStmt, ok := program.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		t.Fatalf("s not *ast.ImportStatement. got=%T", program.Statements[0])
+	}
+	if importStmt.Path != "lib/strings.monkey" || importStmt.Name.Value != "s" {
+		t.Errorf("wrong import. got path=%q, name=%q", importStmt.Path, importStmt.Name.Value)
+	}
+	if program.String() != `import "lib/strings.monkey" as s;export let x = 1;export const y = 2;let z = 3;` {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+	exports := program.Exports()
+	if len(exports) != 2 || exports[0] != "x" || exports[1] != "y" {
+		t.Errorf("wrong exports. got=%v", exports)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "a" s;`, "expected next token to be AS, got IDENT instead"},
+		{`import a as s;`, "expected next token to be STRING, got IDENT instead"},
+		{`export x;`, "expected let or const after export, got IDENT instead"},
+		{`fn() { export let x = 1; }`, "export is only allowed at the top level"},
+		{`if (true) { export let x = 1; }`, "export is only allowed at the top level"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want=%q, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("s.TokenLiteral not 'let'. got=%q", s.TokenLiteral())
@@ -231,6 +301,22 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	input := "100000000000000000000;"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Big == nil || literal.Big.String() != "100000000000000000000" {
+		t.Errorf("literal.Big not %s. got=%v", "100000000000000000000", literal.Big)
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -453,9 +539,128 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a.b.c * d",
+			"(((a.b).c) * d)",
+		},
+		{
+			"-a.b[1] + f(a.b)",
+			"((-((a.b)[1])) + f((a.b)))",
+		},
+		{
+			"a.f(1)",
+			"(a.f)(1)",
+		},
+		{
+			"a[1:2]",
+			"(a[1:2])",
+		},
+		{
+			"a[:-1] + b[x + 1:]",
+			"((a[:(-1)]) + (b[(x + 1):]))",
+		},
+		{
+			"a[:]",
+			"(a[:])",
+		},
+		{
+			"a[0] = b[1] = 1 + 2",
+			"((a[0]) = ((b[1]) = (1 + 2)))",
+		},
+		{
+			"a.b = c == d",
+			"((a.b) = (c == d))",
+		},
+		{
+			"xs |> map(f) |> sum()",
+			"sum(map(xs, f))",
+		},
+		{
+			"a + b |> f |> g(c * d)",
+			"g(f((a + b)), (c * d))",
+		},
+		{
+			"x = y |> f()",
+			"",
+		},
+		{
+			"h[k] = y |> f(1)",
+			"((h[k]) = f(y, 1))",
+		},
+		{
+			"xs |> fn(x) { x }",
+			"fn(x) x(xs)",
+		},
+		{
+			"map(xs, x => x * 2)",
+			"map(xs, fn(x) (x * 2))",
+		},
+		{
+			"(a, b) => a + b",
+			"fn(a, b) (a + b)",
+		},
+		{
+			"() => 1",
+			"fn() 1",
+		},
+		{
+			"(a) * b",
+			"(a * b)",
+		},
+		{
+			"(a) => { let b = a; b }",
+			"fn(a) let b = a;b",
+		},
+		{
+			"x => y => x + y",
+			"fn(x) fn(y) (x + y)",
+		},
+		{
+			"[...a, 1, ...b + c]",
+			"[...a, 1, ...(b + c)]",
+		},
+		{
+			"f(...args, x)",
+			"f(...args, x)",
+		},
+		{
+			"xs |> f(...rest)",
+			"f(xs, ...rest)",
+		},
+		{
+			`{...defaults, "a": 1, ...overrides}`,
+			`{...defaults, a:1, ...overrides}`,
+		},
+		{
+			"a + 1 in s == true",
+			"(((a + 1) in s) == true)",
+		},
+		{
+			"!x in s",
+			"((!x) in s)",
+		},
+		{
+			"0..n - 1",
+			"(0..(n - 1))",
+		},
+		{
+			"x in 1..=n * 2 step k + 1",
+			"(x in (1..=(n * 2) step (k + 1)))",
+		},
+		{
+			"xs[a..b]",
+			"(xs[(a..b)])",
+		},
+		{
+			"let step = 2; f(step)",
+			"let step = 2;f(step)",
+		},
 	}
 
 	for _, tt := range tests {
+		if tt.expected == "" {
+			continue
+		}
 		l := lexer.New(tt.input)
 		p := New(l)
 		program := p.ParseProgram()
@@ -690,6 +895,74 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
 
+func TestCallExpressionKeywordArguments(t *testing.T) {
+	input := "connect(h, port: 80, tls: x == 1);"
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	exp := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+	testIdentifier(t, exp.Arguments[0], "h")
+	for i, name := range []string{"port", "tls"} {
+		kw, ok := exp.Arguments[i+1].(*ast.KeywordArgument)
+		if !ok {
+			t.Fatalf("argument %d is not ast.KeywordArgument. got=%T", i+1, exp.Arguments[i+1])
+		}
+		testIdentifier(t, kw.Name, name)
+	}
+	testInfixExpression(t, exp.Arguments[2].(*ast.KeywordArgument).Value, "x", "==", 1)
+	if exp.String() != "connect(h, port: 80, tls: (x == 1))" {
+		t.Errorf("wrong String(). got=%q", exp.String())
+	}
+
+	p = New(lexer.New("f(a: 1, 2)"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0] != "positional argument after keyword argument" {
+		t.Errorf("wrong parser errors. got=%v", p.Errors())
+	}
+}
+
+func TestDeferStatements(t *testing.T) {
+	input := "fn() { defer close(f, force: true); 1 }"
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if !fn.Defers {
+		t.Errorf("function doesn't defer")
+	}
+	stmt, ok := fn.Body.Statements[0].(*ast.DeferStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.DeferStatement. got=%T", fn.Body.Statements[0])
+	}
+	if stmt.String() != "defer close(f, force: true);" {
+		t.Errorf("wrong String(). got=%q", stmt.String())
+	}
+
+	program = New(lexer.New("fn() { fn() { defer f() } }")).ParseProgram()
+	outer := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if outer.Defers {
+		t.Errorf("outer function defers")
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"defer f()", "defer outside of a function"},
+		{"fn() { defer 1 }", "defer needs a call, got 1"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want=%q, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	input := `"hello world";`
 	l := lexer.New(input)
@@ -744,6 +1017,494 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingMemberExpressions(t *testing.T) {
+	input := "config.server"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	memberExp, ok := stmt.Expression.(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.MemberExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, memberExp.Object, "config") {
+		return
+	}
+	if !testIdentifier(t, memberExp.Member, "server") {
+		return
+	}
+}
+
+func TestParsingMemberExpressionErrors(t *testing.T) {
+	l := lexer.New("config.1")
+	p := New(l)
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+	expected := "expected next token to be IDENT, got INT instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestParsingPipeExpressions(t *testing.T) {
+	input := "xs |> filter(f)"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, exp.Function, "filter") {
+		return
+	}
+	if len(exp.Arguments) != 2 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+	testIdentifier(t, exp.Arguments[0], "xs")
+	testIdentifier(t, exp.Arguments[1], "f")
+	if exp.Token.Literal != "|>" || exp.Token.Line != 1 || exp.Token.Column != 4 {
+		t.Errorf("call should keep the |> token. got=%+v", exp.Token)
+	}
+}
+
+func TestArrowFunctionParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{input: "x => x", expectedParams: []string{"x"}},
+		{input: "() => x", expectedParams: []string{}},
+		{input: "(a) => a", expectedParams: []string{"a"}},
+		{input: "(a, b, c) => { a }", expectedParams: []string{"a", "b", "c"}},
+		{input: "(x: int) => x", expectedParams: []string{"x"}},
+		{input: "(x: int, y: int) => x + y", expectedParams: []string{"x", "y"}},
+		{input: "(x, f: fn(int, int) -> int) -> int => f(x, x)", expectedParams: []string{"x", "f"}},
+		{input: "(xs: [int] | {string: int}) => { xs }", expectedParams: []string{"xs"}},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function, ok := stmt.Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+		}
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d\n",
+				len(tt.expectedParams), len(function.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+		if len(function.Body.Statements) != 1 {
+			t.Errorf("function.Body.Statements has not 1 statements. got=%d\n",
+				len(function.Body.Statements))
+		}
+	}
+
+	// the annotations are kept like a function literal's
+	l := lexer.New("(x, y: int) -> [int] => [x, y]")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(function.ParameterTypes) != 2 || function.ParameterTypes[0] != nil ||
+		function.ParameterTypes[1].String() != "int" {
+		t.Errorf("parameter types wrong. got=%v", function.ParameterTypes)
+	}
+	if function.ReturnType == nil || function.ReturnType.String() != "[int]" {
+		t.Errorf("return type wrong. got=%v", function.ReturnType)
+	}
+
+	// a parenthesized expression is still one
+	l = lexer.New("(x)")
+	p = New(l)
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+	testIdentifier(t, program.Statements[0].(*ast.ExpressionStatement).Expression, "x")
+
+	// arrow functions get named by let like any other function literal
+	l = lexer.New("let double = x => x * 2;")
+	p = New(l)
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+	function = program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if function.Name != "double" {
+		t.Errorf("function literal name wrong. want 'double', got=%q", function.Name)
+	}
+}
+
+func TestParsingSpreadElements(t *testing.T) {
+	input := `{"b": 2, ...h, "a": 1}`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+	if len(hash.Pairs) != 2 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+	if len(hash.Keys) != 3 {
+		t.Fatalf("hash.Keys has wrong length. got=%d", len(hash.Keys))
+	}
+	spread, ok := hash.Keys[1].(*ast.SpreadElement)
+	if !ok {
+		t.Fatalf("hash.Keys[1] is not ast.SpreadElement. got=%T", hash.Keys[1])
+	}
+	testIdentifier(t, spread.Value, "h")
+
+	l = lexer.New("let x = ...a;")
+	p = New(l)
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected a parser error for a spread outside of a list")
+	}
+}
+
+func TestParsingComprehensions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[x * 2 for x in xs]", "[(x * 2) for x in xs]"},
+		{"[x for x in xs if x > 0]", "[x for x in xs if (x > 0)]"},
+		{"[i + v for i, v in f(xs)]", "[(i + v) for i, v in f(xs)]"},
+		{"{k: v * 2 for k, v in h}", "{k:(v * 2) for k, v in h}"},
+		{"{x: true for x in [1, 2] if x != 1}", "{x:true for x in [1, 2] if (x != 1)}"},
+		{"[[y for y in x] for x in xs]", "[[y for y in x] for x in xs]"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	for _, input := range []string{"[x for in xs]", "[x for x xs]", "[x for a, b, c in xs]", "[x, y for x in xs]"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected a parser error for %q", input)
+		}
+	}
+}
+
+func TestParsingForStatements(t *testing.T) {
+	tests := []struct {
+		input     string
+		variables []string
+		expected  string
+	}{
+		{"for (x in xs) { puts(x) }", []string{"x"}, "for (x in xs) puts(x)"},
+		{"for (k, v in h) { k; v };", []string{"k", "v"}, "for (k, v in h) kv"},
+		{"for (x in 0..n) { }", []string{"x"}, "for (x in (0..n)) "},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("statement is not ast.ForStatement. got=%T", program.Statements[0])
+		}
+		if len(stmt.Variables) != len(tt.variables) {
+			t.Fatalf("wrong number of variables. want=%d, got=%d", len(tt.variables), len(stmt.Variables))
+		}
+		for i, v := range tt.variables {
+			testIdentifier(t, stmt.Variables[i], v)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong String(). want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+
+	for _, input := range []string{"for x in xs { x }", "for (x in xs) x", "for (1 in xs) { }"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestParsingSetLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"#{}", "#{}"},
+		{"#{1, 2 * 3, \"a\"}", "#{1, (2 * 3), a}"},
+		{"#{...xs, 1}", "#{...xs, 1}"},
+		{"#{x * 2 for x in xs if x > 0}", "#{(x * 2) for x in xs if (x > 0)}"},
+		{"[x for x in xs if x in s]", "[x for x in xs if (x in s)]"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	for _, input := range []string{"#{1, 2", "#{x for x xs}", "#{1: 2}"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected a parser error for %q", input)
+		}
+	}
+}
+
+func TestParsingTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { f() } catch (e) { g(e) }", "try f() catch (e) g(e)"},
+		{"try { f() } catch { 1 } finally { g() }", "try f() catch 1 finally g()"},
+		{"try { f() } finally { g() }", "try f() finally g()"},
+		{"let x = try { 1 } catch (e) { 2 };", "let x = try 1 catch (e) 2;"},
+		{"throw 1 + 2;", "throw (1 + 2);"},
+		{`fn() { throw "x" }`, `fn() throw x;`},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"try { 1 }", "expected catch or finally after try block"},
+		{"try { 1 } catch (1) { 2 }", "expected next token to be IDENT, got INT instead"},
+		{"try 1 catch { 2 }", "expected next token to be {, got INT instead"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want=%q, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestParsingStructStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, y }", "struct Point { x, y }"},
+		{"struct Point { x, y, };", "struct Point { x, y }"},
+		{"struct Unit {}", "struct Unit {  }"},
+		{"struct P { x } let p = P(1); p.x", "struct P { x }let p = P(1);(p.x)"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, x }", "duplicate field x in struct Point"},
+		{"struct { x }", "expected next token to be IDENT, got { instead"},
+		{"struct Point { x y }", "expected next token to be ,, got IDENT instead"},
+		{"struct Point { 1 }", "expected next token to be IDENT, got INT instead"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want=%q, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestParsingYieldExpressions(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  string
+		generator bool
+	}{
+		{"fn() { yield 1 + 2 }", "fn() yield (1 + 2)", true},
+		{"fn() { yield; 1 }", "fn() yield1", true},
+		{"fn() { let x = yield 1; x }", "fn() let x = yield 1;x", true},
+		{"fn() { f(yield, 2) }", "fn() f(yield, 2)", true},
+		{"fn(g) { yield* g }", "fn(g) yield* g", true},
+		{"() => yield 1", "fn() yield 1", true},
+		// a yield makes only the innermost function a generator
+		{"fn() { fn() { yield 1 } }", "fn() fn() yield 1", false},
+		{"fn() { 1 }", "fn() 1", false},
+		// a comprehension may make a generator, or follow a yield
+		{"fn() { [fn() { yield x } for x in xs] }", "fn() [fn() yield x for x in xs]", false},
+		{"fn() { yield 1; [x for x in xs] }", "fn() yield 1[x for x in xs]", true},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		fn := stmt.Expression.(*ast.FunctionLiteral)
+		if fn.Generator != tt.generator {
+			t.Errorf("wrong Generator for %q. want=%t, got=%t", tt.input, tt.generator, fn.Generator)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"yield 1", "yield outside of a function"},
+		// a comprehension runs as a function of its own
+		{"fn() { [yield x for x in xs] }", "yield inside a comprehension"},
+		{"fn() { #{x for x in yield} }", "yield inside a comprehension"},
+		{"fn() { {k: v for k, v in h if yield} }", "yield inside a comprehension"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want=%q, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestParsingEnumStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"enum Status { Pending, Done(result), Failed(code, reason) }",
+			"enum Status { Pending, Done(result), Failed(code, reason) }"},
+		{"enum E { A, };", "enum E { A }"},
+		{"enum E { A() }", "enum E { A }"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"enum E { A, B, A }", "duplicate variant A in enum E"},
+		{"enum E { A B }", "expected next token to be ,, got IDENT instead"},
+		{"enum { A }", "expected next token to be IDENT, got { instead"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want=%q, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestParsingClassStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"class A {}", "class A { }"},
+		{"class A { init(x) { self.x = x } get() { self.x } }",
+			"class A { init(x) ((self.x) = x) get() (self.x) }"},
+		{"class B extends A { f(a, b) { super.f(a) + b }; }", "class B extends A { f(a, b) (super.f(a) + b) }"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"class A { f() { 1 } f() { 2 } }", "duplicate method f in class A"},
+		{"class A extends { }", "expected next token to be IDENT, got { instead"},
+		{"class A { f { 1 } }", "expected next token to be (, got { instead"},
+		{"super", "expected next token to be ., got EOF instead"},
+		{"super.1", "expected next token to be IDENT, got INT instead"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want=%q, got=%v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestParsingAssignExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 1", "invalid assignment target: x"},
+		{"f(x) = 1", "invalid assignment target: f(x)"},
+		{"a + b = 1", "invalid assignment target: (a + b)"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q, got none", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 	l := lexer.New(input)
@@ -853,3 +1614,44 @@ func TestFunctionLiteralWithName(t *testing.T) {
 			function.Name)
 	}
 }
+
+func TestParsingTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let n: int = 1;", "let n: int = 1;"},
+		{"const names: [string] = [];", "const names: [string] = [];"},
+		{"let h: {string: [int]} = {};", "let h: {string: [int]} = {};"},
+		{"let v: int | string | null = 1;", "let v: int | string | null = 1;"},
+		{"let f: fn(int, string) -> bool = g;", "let f: fn(int, string) -> bool = g;"},
+		{"let f: fn() = g;", "let f: fn() = g;"},
+		{"let f: (fn(int) -> int) | null = g;", "let f: fn(int) -> int | null = g;"},
+		{"fn(x: int, ys: [string]) -> bool { true }", "fn(x: int, ys: [string]) -> bool true"},
+		// only some parameters annotated
+		{"fn(x, y: int) { x }", "fn(x, y: int) x"},
+		{"fn(x: int, y) { x }", "fn(x: int, y) x"},
+		{"fn() -> {string: int} { {} }", "fn() -> {string: int} {}"},
+		{"class A { add(x: int) -> int { x } }", "class A { add(x: int) -> int x }"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	program := New(lexer.New("fn(x, y: int) { x }")).ParseProgram()
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if fn.ParameterType(0) != nil || fn.ParameterType(1).String() != "int" || !fn.Annotated() {
+		t.Errorf("wrong parameter types. got=%v", fn.ParameterTypes)
+	}
+
+	p := New(lexer.New("let n: = 1"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0] != "expected a type, got =" {
+		t.Errorf("wrong parser errors. got=%v", p.Errors())
+	}
+}
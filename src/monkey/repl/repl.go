@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 
+	"sawyer.com/v9/src/monkey/checker"
 	"sawyer.com/v9/src/monkey/compiler"
 	"sawyer.com/v9/src/monkey/lexer"
 	"sawyer.com/v9/src/monkey/object"
@@ -20,6 +21,8 @@ func Start(in io.Reader, out io.Writer) {
 	constants := []object.Object{}
 	globals := make([]object.Object, vm.GlobalsSize)
 	symbolTable := compiler.NewSymbolTable()
+	// remembers the types of the names defined on earlier lines
+	typeChecker := checker.New()
 	// initialize builtin functions
 	for i, v := range object.Builtins {
 		symbolTable.DefineBuiltin(i, v.Name)
@@ -39,6 +42,10 @@ func Start(in io.Reader, out io.Writer) {
 			printParserErrors(out, p.Errors())
 			continue
 		}
+		if errs := typeChecker.Check(program); len(errs) != 0 {
+			printTypeErrors(out, errs)
+			continue
+		}
 		comp := compiler.NewWithState(symbolTable, constants)
 		err := comp.Compile(program)
 		// comp.Bytecode().PrintString()
@@ -84,3 +91,10 @@ func printParserErrors(out io.Writer, errors []string) {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
+
+func printTypeErrors(out io.Writer, errors []string) {
+	io.WriteString(out, "Woops! Type checking failed:\n")
+	for _, msg := range errors {
+		io.WriteString(out, "\t"+msg+"\n")
+	}
+}
@@ -0,0 +1,55 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConstAcrossLines(t *testing.T) {
+	input := strings.Join([]string{
+		"const answer = 42;",
+		"let answer = 1;",
+		"answer",
+	}, "\n")
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	output := out.String()
+	if !strings.Contains(output, "cannot reassign const answer") {
+		t.Errorf("expected const redefinition to be refused, got:\n%s", output)
+	}
+	if !strings.HasSuffix(output, "42\n"+PROMPT) {
+		t.Errorf("expected const to keep its value, got:\n%s", output)
+	}
+}
+
+func TestTypeErrorsBeforeRunning(t *testing.T) {
+	input := strings.Join([]string{
+		"let double = fn(x: int) -> int { x * 2 };",
+		`double("a")`,
+		"double(4)",
+	}, "\n")
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	output := out.String()
+	if !strings.Contains(output, "1:7: cannot use string as int in argument 1 of double") {
+		t.Errorf("expected the argument to be refused, got:\n%s", output)
+	}
+	if !strings.HasSuffix(output, "8\n"+PROMPT) {
+		t.Errorf("expected the checked line to run, got:\n%s", output)
+	}
+}
+
+func TestEvalSeesEarlierLines(t *testing.T) {
+	input := strings.Join([]string{
+		"let rate = 3;",
+		`let price = eval("fn(n) { n * rate }");`,
+		"price(5)",
+	}, "\n")
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	output := out.String()
+	if !strings.HasSuffix(output, "15\n"+PROMPT) {
+		t.Errorf("expected eval to see the globals of earlier lines, got:\n%s", output)
+	}
+}
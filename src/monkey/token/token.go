@@ -3,13 +3,30 @@ package token
 type TokenType string
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"const":   CONST,
+	"true":    TRUE,
+	"false":   FALSE,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"for":     FOR,
+	"in":      IN,
+	"import":  IMPORT,
+	"export":  EXPORT,
+	"as":      AS,
+	"throw":   THROW,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"struct":  STRUCT,
+	"class":   CLASS,
+	"extends": EXTENDS,
+	"super":   SUPER,
+	"enum":    ENUM,
+	"yield":   YIELD,
+	"defer":   DEFER,
 }
 
 // apart user-defined identifier from language keywords
@@ -46,7 +63,21 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	PIPE  = "|>" // x |> f(a) equals to f(x, a)
+	ARROW = "=>" // x => x * 2, shorthand function literal
+
+	// type annotations, fn(x: int | string) -> bool
+	THIN_ARROW = "->"
+	BAR        = "|"
+
+	ELLIPSIS = "..." // spread, f(...args)
+
+	// ranges, 0..n and 1..=n
+	DOTDOT    = ".."
+	DOTDOT_EQ = "..="
+
 	// Delimiters
+	DOT       = "."
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
@@ -56,17 +87,39 @@ const (
 	LBRACE = "{"
 	RBRACE = "}"
 
+	SET_LBRACE = "#{" // set literal, #{1, 2}
+
 	// Keywords
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	FOR      = "FOR"
+	IN       = "IN"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	AS       = "AS"
+	THROW    = "THROW"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	STRUCT   = "STRUCT"
+	CLASS    = "CLASS"
+	EXTENDS  = "EXTENDS"
+	SUPER    = "SUPER"
+	ENUM     = "ENUM"
+	YIELD    = "YIELD"
+	DEFER    = "DEFER"
 )
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	// where the token starts in the input, both 1-based
+	Line   int
+	Column int
 }
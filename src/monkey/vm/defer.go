@@ -0,0 +1,58 @@
+package vm
+
+import (
+	"sawyer.com/v9/src/monkey/object"
+)
+
+// a call queued by defer, with its arguments evaluated already
+type deferredCall struct {
+	fn       object.Object
+	args     []object.Object
+	keywords []string // name the last of args
+}
+
+// the callee and the array of its arguments are on the stack
+func (vm *VM) executeDefer(names *object.Array) error {
+	args := vm.pop().(*object.Array)
+	fn := vm.pop()
+	call := deferredCall{fn: fn, args: args.Elements}
+	for _, name := range names.Elements {
+		call.keywords = append(call.keywords, name.(*object.String).Value)
+	}
+	frame := vm.currentFrame()
+	frame.deferred = append(frame.deferred, call)
+	return nil
+}
+
+// run the calls the frame deferred, the last one first. each runs to its end
+// on a VM of its own, like a spawned task but waited for. an error from one
+// replaces an earlier one, and the rest still run
+func (vm *VM) runDeferred(frame *Frame) error {
+	if len(frame.deferred) == 0 {
+		return nil
+	}
+	var err error
+	forked := vm.fork()
+	for len(frame.deferred) > 0 {
+		call := frame.deferred[len(frame.deferred)-1]
+		frame.deferred = frame.deferred[:len(frame.deferred)-1]
+		_, callErr := forked.call(call.fn, call.args, call.keywords)
+		if callErr != nil {
+			err = callErr
+			// it stopped halfway, the next call gets a VM of its own
+			forked = vm.fork()
+		}
+	}
+	return err
+}
+
+// run the deferred calls of the frames a throw leaves, from the top one down
+// to the one at framesIndex. an error from one of them replaces err
+func (vm *VM) unwind(err error, framesIndex int) error {
+	for i := vm.framesIndex - 1; i >= framesIndex; i-- {
+		if deferErr := vm.runDeferred(vm.frames[i]); deferErr != nil {
+			err = deferErr
+		}
+	}
+	return err
+}
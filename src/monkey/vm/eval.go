@@ -0,0 +1,84 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"sawyer.com/v9/src/monkey/ast"
+	"sawyer.com/v9/src/monkey/compiler"
+	"sawyer.com/v9/src/monkey/lexer"
+	"sawyer.com/v9/src/monkey/object"
+	"sawyer.com/v9/src/monkey/parser"
+)
+
+// eval(src, env?) compiles src as the body of a function taking the keys of
+// env, against the globals of the program or module it's called in, and
+// calls it with env's values on a VM of its own. it gives what the body's last expression or
+// return does. a parse or compile error is thrown like a runtime error
+func (vm *VM) eval(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return &object.Error{Message: fmt.Sprintf(
+			"wrong number of arguments. got=%d, want=1 or 2", len(args))}
+	}
+	src, ok := args[0].(*object.String)
+	if !ok {
+		return &object.Error{Message: fmt.Sprintf(
+			"argument to `eval` must be STRING, got %s", args[0].Type())}
+	}
+	lit := &ast.FunctionLiteral{Parameters: []*ast.Identifier{}}
+	values := []object.Object{}
+	if len(args) == 2 {
+		env, ok := args[1].(*object.Hash)
+		if !ok {
+			return &object.Error{Message: fmt.Sprintf(
+				"env of `eval` must be HASH, got %s", args[1].Type())}
+		}
+		for _, pair := range env.OrderedPairs() {
+			name, ok := pair.Key.(*object.String)
+			if !ok {
+				return &object.Error{Message: fmt.Sprintf(
+					"env of `eval` must have STRING keys, got %s", pair.Key.Type())}
+			}
+			lit.Parameters = append(lit.Parameters, &ast.Identifier{Value: name.Value})
+			values = append(values, pair.Value)
+		}
+	}
+
+	p := parser.New(lexer.New(src.Value))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return &object.Error{Message: "eval: " + strings.Join(p.Errors(), "; ")}
+	}
+	lit.Body = &ast.BlockStatement{Statements: program.Statements}
+
+	symbolTable, constants, globals := vm.symbolTable, vm.mainConstants, vm.mainGlobals
+	if module := vm.currentFrame().cl.Fn.Module; module != nil {
+		symbolTable = module.SymbolTable.(*compiler.SymbolTable)
+		constants, globals = module.Constants, module.Globals
+	}
+	// appending to a copy, a task may be compiling alongside
+	known := len(constants)
+	comp := compiler.NewWithState(symbolTable, constants[:known:known])
+	// the globals defined after the call haven't been set yet
+	comp.RunningGlobals(globals)
+	err := comp.Compile(lit)
+	if err != nil {
+		return &object.Error{Message: "eval: " + err.Error()}
+	}
+	constants = comp.Bytecode().Constants
+	// the functions compiled here run with their constants wherever they're
+	// called, and with the globals of where eval was called
+	namespace := &object.Module{Name: "eval", Constants: constants, Globals: globals, SymbolTable: symbolTable}
+	for _, c := range constants[known:] {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			fn.Module = namespace
+		}
+	}
+	// the function literal is the last constant added
+	fn := constants[len(constants)-1].(*object.CompiledFunction)
+	result, err := vm.fork().call(&object.Closure{Fn: fn}, values, nil)
+	if err != nil {
+		return errorObject(err)
+	}
+	return result
+}
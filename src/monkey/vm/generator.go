@@ -0,0 +1,104 @@
+package vm
+
+import (
+	"fmt"
+
+	"sawyer.com/v9/src/monkey/object"
+)
+
+// a generator runs its function on a VM of its own, so the function's frame
+// and its part of the stack stay put while it's paused at a yield.
+// the generator's VM shares the constants and globals of the calling one
+func (vm *VM) newGenerator(cl *object.Closure, args []object.Object) *object.Generator {
+	g := vm.fork()
+
+	started, running, done := false, false, false
+	resume := func(sent object.Object) (object.Object, bool) {
+		if done {
+			return Null, true
+		}
+		if running {
+			return &object.Error{Message: "generator is already running"}, true
+		}
+		if started {
+			// what the paused yield evaluates to
+			g.push(sent)
+		} else {
+			started = true
+			// the closure and its arguments, like a call leaves them
+			g.stack[0] = cl
+			copy(g.stack[1:], args)
+			frame := NewFrame(cl, 1)
+			g.pushFrame(frame)
+			g.sp = frame.basePointer + cl.Fn.NumLocals
+		}
+		running = true
+		err := g.Run()
+		running = false
+		if err != nil {
+			done = true
+			return errorObject(err), true
+		}
+		if g.yielded {
+			g.yielded = false
+			return g.pop(), false
+		}
+		// returned, the bottom frame is current again
+		done = true
+		return g.pop(), true
+	}
+	closeGenerator := func() bool {
+		if running {
+			return false
+		}
+		// the paused frame and its stack can go
+		done, g = true, nil
+		return true
+	}
+	return &object.Generator{Resume: resume, Close: closeGenerator}
+}
+
+// gen.next() and gen.next(v), the result is {"value": v, "done": false},
+// or what the function returned and done when it's finished
+func (vm *VM) generatorNext(g *object.Generator) *object.Builtin {
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		var sent object.Object = Null
+		switch len(args) {
+		case 0:
+		case 1:
+			sent = args[0]
+		default:
+			return &object.Error{Message: fmt.Sprintf(
+				"wrong number of arguments. got=%d, want=0 or 1", len(args))}
+		}
+		value, done := g.Resume(sent)
+		if errObj, ok := value.(*object.Error); ok {
+			return errObj
+		}
+		return generatorStep(value, done)
+	}}
+}
+
+// gen.close() ends it, so the next next() is done. a paused yield never
+// resumes, and the rest of the function doesn't run
+func generatorClose(g *object.Generator) *object.Builtin {
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		if len(args) != 0 {
+			return &object.Error{Message: fmt.Sprintf(
+				"wrong number of arguments. got=%d, want=0", len(args))}
+		}
+		if !g.Close() {
+			return &object.Error{Message: "generator is already running"}
+		}
+		return Null
+	}}
+}
+
+func generatorStep(value object.Object, done bool) *object.Hash {
+	valueKey := &object.String{Value: "value"}
+	doneKey := &object.String{Value: "done"}
+	return &object.Hash{Pairs: map[object.HashKey]object.HashPair{
+		valueKey.HashKey(): {Key: valueKey, Value: value},
+		doneKey.HashKey():  {Key: doneKey, Value: nativeBoolToBooleanObject(done)},
+	}}
+}
@@ -0,0 +1,56 @@
+package vm
+
+import (
+	"fmt"
+
+	"sawyer.com/v9/src/monkey/object"
+)
+
+// an iterator over obj: the builtin iterables, and anything with a next
+// method returning {"value": v, "done": false} until {"done": true},
+// like a generator. a function on its own is a next method, a closure
+// counting up is an iterator. next is called on a VM of its own
+func (vm *VM) iterate(obj object.Object) (*object.Iterator, *object.Error) {
+	next, ok := vm.nextMethod(obj)
+	if !ok {
+		iterator, ok := object.NewIterator(obj)
+		if !ok {
+			return nil, &object.Error{Message: fmt.Sprintf("cannot iterate over %s", obj.Type())}
+		}
+		return iterator, nil
+	}
+	var forked *VM
+	return object.NewStepIterator(func() (object.Object, bool, *object.Error) {
+		if forked == nil {
+			forked = vm.fork()
+		}
+		result, err := forked.call(next, nil, nil)
+		if err != nil {
+			return nil, false, errorObject(err)
+		}
+		return object.IteratorResult(result)
+	}), nil
+}
+
+// the next method of obj, when it has one. a hash without a function
+// under "next" is iterated over its keys
+func (vm *VM) nextMethod(obj object.Object) (object.Object, bool) {
+	switch obj := obj.(type) {
+	case *object.Generator:
+		return vm.generatorNext(obj), true
+	case *object.Closure, *object.Builtin, *object.BoundMethod:
+		return obj, true
+	case *object.Instance:
+		return obj.Get("next")
+	case *object.Hash:
+		pair, ok := obj.Pairs[(&object.String{Value: "next"}).HashKey()]
+		if !ok {
+			return nil, false
+		}
+		switch pair.Value.(type) {
+		case *object.Closure, *object.Builtin, *object.BoundMethod:
+			return pair.Value, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,56 @@
+package vm
+
+import (
+	"sawyer.com/v9/src/monkey/ast"
+	"sawyer.com/v9/src/monkey/compiler"
+	"sawyer.com/v9/src/monkey/module"
+	"sawyer.com/v9/src/monkey/object"
+)
+
+// Modules loads what import statements ask for, shared by every VM
+// so a module runs once. set its SearchPath to configure where modules are found
+var Modules *module.Loader
+
+func init() {
+	// not in the declaration, running a module refers back to Modules
+	Modules = NewLoader(module.DefaultSearchPath())
+}
+
+// a loader that compiles modules and runs them on a VM of their own
+func NewLoader(searchPath []string) *module.Loader {
+	return module.NewLoader(runModule, searchPath)
+}
+
+// every module has its own symbol table, constants and globals,
+// its functions keep using them when called from another module
+func runModule(name string, program *ast.Program) (*object.Module, error) {
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+	bytecode := comp.Bytecode()
+
+	mod := &object.Module{
+		Name:        name,
+		Exports:     make(map[string]object.Object),
+		Constants:   bytecode.Constants,
+		Globals:     make([]object.Object, GlobalsSize),
+		SymbolTable: bytecode.SymbolTable,
+	}
+	for _, c := range bytecode.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			fn.Module = mod
+		}
+	}
+
+	machine := NewWithGlobalsStore(bytecode, mod.Globals)
+	err = machine.Run()
+	if err != nil {
+		return nil, err
+	}
+	for name, index := range bytecode.Exports {
+		mod.Exports[name] = mod.Globals[index]
+	}
+	return mod, nil
+}
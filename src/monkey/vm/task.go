@@ -0,0 +1,95 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"sawyer.com/v9/src/monkey/object"
+)
+
+// a VM of its own to run functions on, with a stack and frames of its own.
+// it shares the constants and globals of this one, the main program's
+// and every module's. constants never change once compiled, and a global
+// is set once, by top-level code, before any code compiled after it can
+// read it, so sharing them is safe
+func (vm *VM) fork() *VM {
+	bottom := NewFrame(&object.Closure{Fn: &object.CompiledFunction{}}, 0)
+	forked := &VM{
+		stack:         make([]object.Object, StackSize),
+		frames:        make([]*Frame, MaxFrames),
+		framesIndex:   1,
+		mainConstants: vm.mainConstants,
+		mainGlobals:   vm.mainGlobals,
+		symbolTable:   vm.symbolTable,
+	}
+	forked.frames[0] = bottom
+	forked.useNamespace(bottom)
+	forked.bindBuiltins()
+	return forked
+}
+
+func (vm *VM) bindBuiltins() {
+	vm.builtins = make([]*object.Builtin, len(object.Builtins))
+	for i, def := range object.Builtins {
+		vm.builtins[i] = object.BindIterate(def.Name, def.Builtin, vm.iterate)
+		switch def.Name {
+		case "spawn":
+			vm.builtins[i] = &object.Builtin{Fn: vm.spawn}
+		case "eval":
+			vm.builtins[i] = &object.Builtin{Fn: vm.eval}
+		}
+	}
+}
+
+// spawn(f, args...) calls f on a VM of its own, on a goroutine of its own
+func (vm *VM) spawn(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return &object.Error{Message: "wrong number of arguments. got=0, want=at least 1"}
+	}
+	switch args[0].(type) {
+	case *object.Closure, *object.Builtin, *object.BoundMethod, *object.Class,
+		*object.StructType, *object.VariantType:
+	default:
+		return &object.Error{Message: fmt.Sprintf(
+			"argument to `spawn` must be a function, got %s", args[0].Type())}
+	}
+	// args is a window on the stack of this VM, which goes on running
+	args = append([]object.Object{}, args...)
+	task := object.NewTask()
+	forked := vm.fork()
+	go func() {
+		result, err := forked.call(args[0], args[1:], nil)
+		if err != nil {
+			task.Finish(errorObject(err))
+			return
+		}
+		task.Finish(result)
+	}()
+	return task
+}
+
+// call fn with args and run it to the end, on a VM with nothing else to run.
+// keywords name the last of args
+func (vm *VM) call(fn object.Object, args []object.Object, keywords []string) (object.Object, error) {
+	vm.stack[0] = fn
+	copy(vm.stack[1:], args)
+	vm.sp = 1 + len(args)
+	err := vm.executeCall(len(args), keywords)
+	if err != nil {
+		return nil, err
+	}
+	err = vm.Run()
+	if err != nil {
+		return nil, err
+	}
+	return vm.pop(), nil
+}
+
+// a runtime error as a value, a thrown value stays the value thrown
+func errorObject(err error) *object.Error {
+	var exception *Exception
+	if errors.As(err, &exception) {
+		return &object.Error{Message: err.Error(), Thrown: exception.Value}
+	}
+	return &object.Error{Message: err.Error()}
+}
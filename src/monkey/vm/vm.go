@@ -1,6 +1,7 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
 
 	"sawyer.com/v9/src/monkey/code"
@@ -28,32 +29,75 @@ type VM struct {
 	// need frame slice to keep track of currently running function instructions
 	frames      []*Frame // stack frame
 	framesIndex int      // index of next executing frame
+
+	// constants and globals of the main program. constants and globals
+	// above are swapped while a function of an imported module runs
+	mainConstants []object.Object
+	mainGlobals   []object.Object
+	// the names of the main program's globals, for eval
+	symbolTable *compiler.SymbolTable
+
+	// the try blocks being run, the innermost is the last
+	handlers []handler
+
+	// set when a generator's function paused at a yield, run returns then
+	yielded bool
+
+	// object.Builtins, with spawn and eval bound to this VM
+	builtins []*object.Builtin
+}
+
+// where to go when something is thrown inside a try block
+type handler struct {
+	framesIndex int // of the frame the try block is in
+	catchPos    int // where its catch (or finally) starts
+	sp          int // the stack as it was when the try block started
+}
+
+// Exception is a value thrown by throw that nothing caught
+type Exception struct {
+	Value object.Object
+}
+
+func (e *Exception) Error() string {
+	return "uncaught exception: " + e.Value.Inspect()
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Stages:       bytecode.Stages,
+	}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
 	// main frame
 	frames := make([]*Frame, MaxFrames)
 	frames[0] = mainFrame
-	return &VM{
+	globals := make([]object.Object, GlobalsSize)
+	vm := &VM{
 		constants: bytecode.Constants,
 		// VM only
 		stack: make([]object.Object, StackSize),
 		sp:    0,
 		// for Identifier binding
-		globals: make([]object.Object, GlobalsSize),
+		globals: globals,
 
 		frames:      frames,
 		framesIndex: 1,
+
+		mainConstants: bytecode.Constants,
+		mainGlobals:   globals,
+		symbolTable:   bytecode.SymbolTable,
 	}
+	vm.bindBuiltins()
+	return vm
 }
 
 func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 	vm := New(bytecode)
 	vm.globals = s
+	vm.mainGlobals = s
 	return vm
 }
 
@@ -64,13 +108,30 @@ func (vm *VM) currentFrame() *Frame {
 func (vm *VM) pushFrame(f *Frame) {
 	vm.frames[vm.framesIndex] = f
 	vm.framesIndex++
+	vm.useNamespace(f)
 }
 
 func (vm *VM) popFrame() *Frame {
 	vm.framesIndex--
+	vm.useNamespace(vm.currentFrame())
+	// returning leaves the try blocks of the function
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].framesIndex > vm.framesIndex {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
 	return vm.frames[vm.framesIndex]
 }
 
+// a function runs with the constants and globals of the module it was compiled in
+func (vm *VM) useNamespace(f *Frame) {
+	if module := f.cl.Fn.Module; module != nil {
+		vm.constants = module.Constants
+		vm.globals = module.Globals
+	} else {
+		vm.constants = vm.mainConstants
+		vm.globals = vm.mainGlobals
+	}
+}
+
 // A temporary storage that lives as long as a function call
 // It's a virtual machine frame implementation, differs to real machine frame implementation
 // Frame: instructions and its pointer
@@ -81,6 +142,10 @@ type Frame struct {
 	ip int
 	// indicates the index of the stack currently being used
 	basePointer int
+	// set for init called by a class, the instance is returned instead
+	constructing *object.Instance
+	// the calls queued by defer, run when the frame returns or is unwound
+	deferred []deferredCall
 }
 
 func NewFrame(cl *object.Closure, basePointer int) *Frame {
@@ -96,8 +161,61 @@ func (f *Frame) Instructions() code.Instructions {
 	return f.cl.Fn.Instructions
 }
 
-// Heart of Virtual Machine: fetch-decode-execute cycle
 func (vm *VM) Run() error {
+	for {
+		err := vm.run()
+		if err == nil {
+			return nil
+		}
+		if len(vm.handlers) == 0 {
+			return vm.unwind(vm.annotateStages(err, 0), 1)
+		}
+		// runtime errors are thrown like any value when there's a try to catch them
+		h := vm.handlers[len(vm.handlers)-1]
+		err = vm.annotateStages(err, h.framesIndex-1)
+		err = vm.unwind(err, h.framesIndex)
+		var thrown object.Object
+		var exception *Exception
+		if errors.As(err, &exception) {
+			thrown = exception.Value
+		} else {
+			thrown = object.ErrorValue(err.Error())
+		}
+		err = vm.catch(thrown)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// unwind the frames to the innermost try block and continue at its catch,
+// with the thrown value on the stack
+func (vm *VM) catch(thrown object.Object) error {
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.framesIndex = h.framesIndex
+	vm.useNamespace(vm.currentFrame())
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.catchPos - 1
+	return vm.push(thrown)
+}
+
+// point a runtime error at the pipeline stages it happened in,
+// looking at the frames above the bottom one.
+// every frame that's not on top rests on the last byte of a call,
+// the top one too when the call itself failed
+func (vm *VM) annotateStages(err error, bottom int) error {
+	for i := vm.framesIndex - 1; i >= bottom; i-- {
+		frame := vm.frames[i]
+		if stage, ok := frame.cl.Fn.Stages[frame.ip]; ok {
+			err = fmt.Errorf("pipeline stage %s: %w", stage, err)
+		}
+	}
+	return err
+}
+
+// Heart of Virtual Machine: fetch-decode-execute cycle
+func (vm *VM) run() error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
@@ -132,6 +250,11 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpCurrentClass:
+			err := vm.push(vm.currentFrame().cl.Class)
+			if err != nil {
+				return err
+			}
 		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
@@ -228,6 +351,47 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpSet:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			set, err := vm.buildSet(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+			err = vm.push(set)
+			if err != nil {
+				return err
+			}
+		case code.OpIn:
+			collection := vm.pop()
+			value := vm.pop()
+			found, err := object.Contains(collection, value)
+			if err != nil {
+				return err
+			}
+			err = vm.push(nativeBoolToBooleanObject(found))
+			if err != nil {
+				return err
+			}
+		case code.OpRange:
+			inclusive := code.ReadUint8(ins[ip+1:]) == 1
+			hasStep := code.ReadUint8(ins[ip+2:]) == 1
+			vm.currentFrame().ip += 2
+			var step object.Object
+			if hasStep {
+				step = vm.pop()
+			}
+			end := vm.pop()
+			start := vm.pop()
+			r, err := object.NewRange(start, end, step, inclusive)
+			if err != nil {
+				return err
+			}
+			err = vm.push(r)
+			if err != nil {
+				return err
+			}
 		case code.OpIndex:
 			index := vm.pop()
 			left := vm.pop()
@@ -235,6 +399,37 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpSlice:
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+			err := vm.executeSliceExpression(left, start, end)
+			if err != nil {
+				return err
+			}
+		case code.OpGetField:
+			name := vm.pop()
+			left := vm.pop()
+			err := vm.executeFieldExpression(left, name)
+			if err != nil {
+				return err
+			}
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err := vm.executeSetIndex(left, index, value)
+			if err != nil {
+				return err
+			}
+		case code.OpSetField:
+			value := vm.pop()
+			name := vm.pop()
+			left := vm.pop()
+			err := vm.executeSetField(left, name, value)
+			if err != nil {
+				return err
+			}
 		case code.OpReturnValue:
 			// function bytecode calling convention:
 			// 1. pop return value if there's one
@@ -243,20 +438,35 @@ func (vm *VM) Run() error {
 			// 4. push return value
 
 			returnValue := vm.pop()
+			err := vm.runDeferred(vm.currentFrame())
+			if err != nil {
+				return err
+			}
 
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1 // pop the function literal
+			if frame.constructing != nil {
+				returnValue = frame.constructing
+			}
 
-			err := vm.push(returnValue)
+			err = vm.push(returnValue)
 			if err != nil {
 				return err
 			}
 		case code.OpReturn:
 			// hitting no return statement
+			err := vm.runDeferred(vm.currentFrame())
+			if err != nil {
+				return err
+			}
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1 // pop the function literal
 
-			err := vm.push(Null)
+			var returnValue object.Object = Null
+			if frame.constructing != nil {
+				returnValue = frame.constructing
+			}
+			err = vm.push(returnValue)
 			if err != nil {
 				return err
 			}
@@ -264,15 +474,114 @@ func (vm *VM) Run() error {
 			// handle operand
 			numArgs := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
-			err := vm.executeCall(int(numArgs))
+			err := vm.executeCall(int(numArgs), nil)
+			if err != nil {
+				return err
+			}
+		case code.OpCallKeywords:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			namesIndex := code.ReadUint16(ins[ip+2:])
+			vm.currentFrame().ip += 3
+			err := vm.executeCall(int(numArgs), vm.keywordNames(int(namesIndex)))
+			if err != nil {
+				return err
+			}
+		case code.OpDefer:
+			namesIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err := vm.executeDefer(vm.constants[namesIndex].(*object.Array))
+			if err != nil {
+				return err
+			}
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err := vm.executeTailCall(int(numArgs), nil)
+			if err != nil {
+				return err
+			}
+		case code.OpTailCallKeywords:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			namesIndex := code.ReadUint16(ins[ip+2:])
+			vm.currentFrame().ip += 3
+			err := vm.executeTailCall(int(numArgs), vm.keywordNames(int(namesIndex)))
+			if err != nil {
+				return err
+			}
+		case code.OpCallSpread:
+			err := vm.executeCallSpread(nil)
+			if err != nil {
+				return err
+			}
+		case code.OpCallSpreadKeywords:
+			namesIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err := vm.executeCallSpread(vm.keywordNames(int(namesIndex)))
+			if err != nil {
+				return err
+			}
+		case code.OpIter:
+			iterator, errObj := vm.iterate(vm.pop())
+			if errObj != nil {
+				return runtimeError(errObj)
+			}
+			err := vm.push(iterator)
+			if err != nil {
+				return err
+			}
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			numValues := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+			err := vm.executeIterNext(vm.pop().(*object.Iterator), int(numValues), pos)
+			if err != nil {
+				return err
+			}
+		case code.OpAppend:
+			value := vm.pop()
+			switch collection := vm.pop().(type) {
+			case *object.Array:
+				collection.Elements = append(collection.Elements, value)
+			case *object.Set:
+				err := collection.Add(value)
+				if err != nil {
+					return err
+				}
+			}
+		case code.OpTry:
+			catchPos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			vm.handlers = append(vm.handlers, handler{
+				framesIndex: vm.framesIndex,
+				catchPos:    catchPos,
+				sp:          vm.sp,
+			})
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case code.OpThrow:
+			return &Exception{Value: vm.pop()}
+		case code.OpImport:
+			pathIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			path := vm.constants[pathIndex].(*object.String)
+			module, err := Modules.Import(path.Value)
+			if err != nil {
+				return err
+			}
+			err = vm.push(module)
+			if err != nil {
+				return err
+			}
+		case code.OpExtend:
+			value := vm.pop()
+			err := vm.executeExtend(vm.StackTop(), value)
 			if err != nil {
 				return err
 			}
 		case code.OpGetBuiltin:
 			builtinIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
-			definition := object.Builtins[builtinIndex]
-			err := vm.push(definition.Builtin)
+			err := vm.push(vm.builtins[builtinIndex])
 			if err != nil {
 				return err
 			}
@@ -280,7 +589,68 @@ func (vm *VM) Run() error {
 			freeIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			currentClosure := vm.currentFrame().cl
-			err := vm.push(currentClosure.Free[freeIndex])
+			free := currentClosure.Free[freeIndex]
+			if box, ok := free.(*object.Box); ok {
+				free = box.Value
+			}
+			err := vm.push(free)
+			if err != nil {
+				return err
+			}
+		case code.OpBox:
+			err := vm.push(&object.Box{})
+			if err != nil {
+				return err
+			}
+		case code.OpFillBox:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			frame := vm.currentFrame()
+			box := vm.stack[frame.basePointer+int(localIndex)].(*object.Box)
+			box.Value = vm.stack[vm.sp-1]
+		case code.OpYield:
+			vm.yielded = true
+			return nil
+		case code.OpClass:
+			numMethods := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+			class, err := vm.buildClass(numMethods)
+			if err != nil {
+				return err
+			}
+			err = vm.push(class)
+			if err != nil {
+				return err
+			}
+		case code.OpGetSuper:
+			name := vm.pop().(*object.String)
+			self := vm.pop()
+			super := vm.pop()
+			err := vm.executeGetSuper(super, self, name.Value)
+			if err != nil {
+				return err
+			}
+		case code.OpGetStructField:
+			offset := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			s, ok := vm.pop().(*object.Struct)
+			if !ok {
+				return fmt.Errorf("struct field access on non-struct")
+			}
+			err := vm.push(s.Fields[offset])
+			if err != nil {
+				return err
+			}
+		case code.OpSetStructField:
+			offset := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			value := vm.pop()
+			s, ok := vm.pop().(*object.Struct)
+			if !ok {
+				return fmt.Errorf("struct field access on non-struct")
+			}
+			s.Fields[offset] = value
+			err := vm.push(value)
 			if err != nil {
 				return err
 			}
@@ -307,6 +677,9 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	// execute fn, clean args on the stack
 	result := builtin.Fn(args...)
 	vm.sp = vm.sp - numArgs - 1
+	if errObj, ok := result.(*object.Error); ok {
+		return runtimeError(errObj)
+	}
 	if result != nil {
 		vm.push(result)
 	} else {
@@ -315,20 +688,235 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	return nil
 }
 
-func (vm *VM) executeCall(numArgs int) error {
+// an error as a value as a runtime error of the vm, or thrown
+func runtimeError(errObj *object.Error) error {
+	if errObj.Thrown != nil {
+		return &Exception{Value: errObj.Thrown}
+	}
+	return errors.New(errObj.Message)
+}
+
+// the class name, superclass and name, closure pairs of the methods are on the stack
+func (vm *VM) buildClass(numMethods int) (*object.Class, error) {
+	methods := make(map[string]object.Object, numMethods)
+	for i := vm.sp - 2*numMethods; i < vm.sp; i += 2 {
+		name := vm.stack[i].(*object.String)
+		methods[name.Value] = vm.stack[i+1]
+	}
+	vm.sp = vm.sp - 2*numMethods
+	super := vm.pop()
+	name := vm.pop().(*object.String)
+	class := &object.Class{Name: name.Value, Methods: methods}
+	for _, method := range methods {
+		if cl, ok := method.(*object.Closure); ok {
+			cl.Class = class
+		}
+	}
+	switch super := super.(type) {
+	case *object.Class:
+		class.Super = super
+	case *object.Null:
+	default:
+		return nil, fmt.Errorf("superclass must be a class, got %s", super.Type())
+	}
+	return class, nil
+}
+
+// super.name, the superclass's method bound to self
+func (vm *VM) executeGetSuper(super, self object.Object, name string) error {
+	class, ok := super.(*object.Class)
+	if !ok {
+		return fmt.Errorf("super used in a class without a superclass")
+	}
+	method, ok := class.Lookup(name)
+	if !ok {
+		return fmt.Errorf("%s has no method %s", class.Name, name)
+	}
+	return vm.push(&object.BoundMethod{Receiver: self.(*object.Instance), Method: method, Name: name})
+}
+
+// calling a struct type makes a struct of the arguments, in field order
+func (vm *VM) construct(st *object.StructType, numArgs int, keywords []string) error {
+	if keywords != nil {
+		err := vm.bindKeywords(st.Fields, numArgs, keywords)
+		if err != nil {
+			return err
+		}
+	}
+	if numArgs != len(st.Fields) {
+		return fmt.Errorf("wrong number of fields for %s: want=%d, got=%d",
+			st.Name, len(st.Fields), numArgs)
+	}
+	fields := make([]object.Object, numArgs)
+	copy(fields, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.sp = vm.sp - numArgs - 1
+	return vm.push(&object.Struct{StructType: st, Fields: fields})
+}
+
+// calling a variant type, Status.Done(1), makes a variant of the arguments
+func (vm *VM) constructVariant(vt *object.VariantType, numArgs int, keywords []string) error {
+	if keywords != nil {
+		err := vm.bindKeywords(vt.Fields, numArgs, keywords)
+		if err != nil {
+			return err
+		}
+	}
+	if numArgs != len(vt.Fields) {
+		return fmt.Errorf("wrong number of fields for %s: want=%d, got=%d",
+			vt.Inspect(), len(vt.Fields), numArgs)
+	}
+	values := make([]object.Object, numArgs)
+	copy(values, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.sp = vm.sp - numArgs - 1
+	return vm.push(&object.Variant{VariantType: vt, Values: values})
+}
+
+// calling a class makes an instance and calls init on it, if there's one.
+// the init frame returns the instance whatever init returns
+func (vm *VM) instantiate(class *object.Class, numArgs int, keywords []string) error {
+	instance := object.NewInstance(class)
+	init, ok := class.Lookup("init")
+	if !ok {
+		if numArgs != 0 {
+			return fmt.Errorf("wrong number of arguments: want=0, got=%d", numArgs)
+		}
+		vm.sp = vm.sp - numArgs - 1
+		return vm.push(instance)
+	}
+	bound := &object.BoundMethod{Receiver: instance, Method: init, Name: "init"}
+	err := vm.callBoundMethod(bound, numArgs, keywords)
+	if err != nil {
+		return err
+	}
+	vm.currentFrame().constructing = instance
+	return nil
+}
+
+// a method takes self as its first parameter, so the receiver
+// is slid in under the arguments
+func (vm *VM) callBoundMethod(bound *object.BoundMethod, numArgs int, keywords []string) error {
+	cl := bound.Method.(*object.Closure)
+	// self is never named
+	if keywords != nil {
+		err := vm.bindKeywords(cl.Fn.Parameters[1:], numArgs, keywords)
+		if err != nil {
+			return err
+		}
+	}
+	if numArgs != cl.Fn.NumParameters-1 {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters-1, numArgs)
+	}
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	copy(vm.stack[vm.sp-numArgs+1:vm.sp+1], vm.stack[vm.sp-numArgs:vm.sp])
+	vm.stack[vm.sp-numArgs] = bound.Receiver
+	vm.sp++
+	return vm.callClosure(cl, numArgs+1, nil)
+}
+
+// the names of a call's keyword arguments, from the constant OpCallKeywords names
+func (vm *VM) keywordNames(namesIndex int) []string {
+	names := vm.constants[namesIndex].(*object.Array)
+	keywords := make([]string, len(names.Elements))
+	for i, name := range names.Elements {
+		keywords[i] = name.(*object.String).Value
+	}
+	return keywords
+}
+
+// keywords name the last of the arguments, when the call has keyword arguments
+func (vm *VM) executeCall(numArgs int, keywords []string) error {
 	// the function being called
 	// -1 for popping the function literal
 	callee := vm.stack[vm.sp-1-numArgs]
 	switch callee := callee.(type) {
 	case *object.Closure:
-		return vm.callClosure(callee, numArgs)
+		return vm.callClosure(callee, numArgs, keywords)
 	case *object.Builtin:
+		if keywords != nil {
+			return fmt.Errorf("builtin functions take no keyword arguments")
+		}
 		return vm.callBuiltin(callee, numArgs)
+	case *object.StructType:
+		return vm.construct(callee, numArgs, keywords)
+	case *object.Class:
+		return vm.instantiate(callee, numArgs, keywords)
+	case *object.VariantType:
+		return vm.constructVariant(callee, numArgs, keywords)
+	case *object.BoundMethod:
+		return vm.callBoundMethod(callee, numArgs, keywords)
 	default:
 		return fmt.Errorf("calling non-function and non-built-in")
 	}
 }
 
+// a call of the array of arguments on top, keywords name the last of them
+func (vm *VM) executeCallSpread(keywords []string) error {
+	args := vm.pop().(*object.Array)
+	for _, arg := range args.Elements {
+		err := vm.push(arg)
+		if err != nil {
+			return err
+		}
+	}
+	return vm.executeCall(len(args.Elements), keywords)
+}
+
+// a call in tail position runs in the caller's frame, with the callee and
+// its arguments moved down over the caller's. the OpReturnValue after the
+// call is never reached, the callee returns for the caller.
+// anything else is called like OpCall, and its result returned by that.
+// keyword arguments are bound to their places before the move
+func (vm *VM) executeTailCall(numArgs int, keywords []string) error {
+	frame := vm.currentFrame()
+	// init has to return its instance, deferred calls have to run
+	// after the call, a try block has to catch
+	if frame.constructing != nil || len(frame.deferred) > 0 ||
+		(len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].framesIndex == vm.framesIndex) {
+		return vm.executeCall(numArgs, keywords)
+	}
+	var cl *object.Closure
+	switch callee := vm.stack[vm.sp-1-numArgs].(type) {
+	case *object.Closure:
+		cl = callee
+		if keywords != nil {
+			err := vm.bindKeywords(cl.Fn.Parameters, numArgs, keywords)
+			if err != nil {
+				return err
+			}
+		}
+	case *object.BoundMethod:
+		cl = callee.Method.(*object.Closure)
+		if keywords != nil {
+			err := vm.bindKeywords(cl.Fn.Parameters[1:], numArgs, keywords)
+			if err != nil {
+				return err
+			}
+		}
+		if numArgs != cl.Fn.NumParameters-1 || cl.Fn.Generator || vm.sp >= StackSize {
+			return vm.callBoundMethod(callee, numArgs, nil)
+		}
+		// self goes under the arguments, like callBoundMethod does
+		copy(vm.stack[vm.sp-numArgs+1:vm.sp+1], vm.stack[vm.sp-numArgs:vm.sp])
+		vm.stack[vm.sp-numArgs] = callee.Receiver
+		vm.sp++
+		numArgs++
+	default:
+		return vm.executeCall(numArgs, keywords)
+	}
+	// callClosure reports the mismatch, or makes the generator
+	if numArgs != cl.Fn.NumParameters || cl.Fn.Generator {
+		return vm.callClosure(cl, numArgs, nil)
+	}
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	callee := NewFrame(cl, frame.basePointer)
+	vm.frames[vm.framesIndex-1] = callee
+	vm.useNamespace(callee)
+	vm.sp = callee.basePointer + cl.Fn.NumLocals
+	return nil
+}
+
 // stack top index: sp - 1
 // free index: sp
 func (vm *VM) StackTop() object.Object {
@@ -363,7 +951,7 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	leftType := left.Type()
 	rightType := right.Type()
 	switch {
-	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+	case object.IsInteger(left) && object.IsInteger(right):
 		return vm.executeBinaryIntegerOperation(op, left, right)
 	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
 		return vm.executeBinaryStringOperation(op, left, right)
@@ -375,30 +963,48 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 func (vm *VM) executeBinaryIntegerOperation(op code.Opcode,
 	left, right object.Object,
 ) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
-	var result int64
+	var operator string
 	switch op {
 	case code.OpAdd:
-		result = leftValue + rightValue
+		operator = "+"
 	case code.OpSub:
-		result = leftValue - rightValue
+		operator = "-"
 	case code.OpMul:
-		result = leftValue * rightValue
+		operator = "*"
 	case code.OpDiv:
-		result = leftValue / rightValue
+		operator = "/"
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
-	return vm.push(&object.Integer{Value: result})
+	// an overflow makes a BigInt
+	result, err := object.IntegerArithmetic(operator, left, right)
+	if err != nil {
+		return err
+	}
+	return vm.push(result)
 }
 
 func (vm *VM) executeComparison(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
-	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
+	if object.IsInteger(left) && object.IsInteger(right) {
 		return vm.executeIntegerComparison(op, left, right)
 	}
+	if l, ok := left.(*object.Struct); ok {
+		if r, ok := right.(*object.Struct); ok {
+			return vm.executeStructComparison(op, l, r)
+		}
+	}
+	if l, ok := left.(*object.Variant); ok {
+		if r, ok := right.(*object.Variant); ok {
+			return vm.executeVariantComparison(op, l, r)
+		}
+	}
+	if l, ok := left.(*object.Set); ok {
+		if r, ok := right.(*object.Set); ok {
+			return vm.executeSetComparison(op, l, r)
+		}
+	}
 	switch op {
 	case code.OpEqual:
 		return vm.push(nativeBoolToBooleanObject(right == left))
@@ -409,18 +1015,53 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 	}
 }
 
+// structs are equal when their fields are
+func (vm *VM) executeStructComparison(op code.Opcode, left, right *object.Struct) error {
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left.Equal(right)))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(!left.Equal(right)))
+	default:
+		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
+	}
+}
+
+// variants are equal when they're the same variant with equal values
+func (vm *VM) executeVariantComparison(op code.Opcode, left, right *object.Variant) error {
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left.Equal(right)))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(!left.Equal(right)))
+	default:
+		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
+	}
+}
+
+// sets are equal when they have the same elements
+func (vm *VM) executeSetComparison(op code.Opcode, left, right *object.Set) error {
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left.Equal(right)))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(!left.Equal(right)))
+	default:
+		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
+	}
+}
+
 func (vm *VM) executeIntegerComparison(op code.Opcode,
 	left, right object.Object,
 ) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+	cmp := object.CompareIntegers(left, right)
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+		return vm.push(nativeBoolToBooleanObject(cmp == 0))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+		return vm.push(nativeBoolToBooleanObject(cmp != 0))
 	case code.OpGreaterThan:
-		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+		return vm.push(nativeBoolToBooleanObject(cmp > 0))
 	default:
 		return fmt.Errorf("unknown operator: %d", op)
 	}
@@ -449,11 +1090,10 @@ func (vm *VM) executeBangOperator() error {
 
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
-	if operand.Type() != object.INTEGER_OBJ {
+	if !object.IsInteger(operand) {
 		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
 	}
-	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
+	return vm.push(object.NegateInteger(operand))
 }
 
 func isTruthy(obj object.Object) bool {
@@ -501,12 +1141,38 @@ func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
 	return &object.Hash{Pairs: hashedPairs}, nil
 }
 
+func (vm *VM) buildSet(startIndex, endIndex int) (object.Object, error) {
+	set := object.NewSet()
+	for i := startIndex; i < endIndex; i++ {
+		err := set.Add(vm.stack[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return vm.executeHashIndex(left, index)
+	case left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ:
+		value, ok := left.(*object.Range).At(index.(*object.Integer).Value)
+		if !ok {
+			return vm.push(Null)
+		}
+		return vm.push(value)
+	case index.Type() == object.RANGE_OBJ:
+		// xs[1..3] slices xs
+		selected, err := object.Select(left, index.(*object.Range))
+		if err != nil {
+			return err
+		}
+		return vm.push(selected)
 	default:
 		return fmt.Errorf("index operator not supported: %s", left.Type())
 	}
@@ -515,13 +1181,87 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	arrayObject := array.(*object.Array)
 	i := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
-	if i < 0 || i > max {
+	length := int64(len(arrayObject.Elements))
+	// negative index counts from the end, a[-1] is the last element
+	if i < 0 {
+		i += length
+	}
+	if i < 0 || i >= length {
 		return vm.push(Null)
 	}
 	return vm.push(arrayObject.Elements[i])
 }
 
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	value := str.(*object.String).Value
+	i := index.(*object.Integer).Value
+	length := int64(len(value))
+	if i < 0 {
+		i += length
+	}
+	if i < 0 || i >= length {
+		return vm.push(Null)
+	}
+	return vm.push(&object.String{Value: value[i : i+1]})
+}
+
+func (vm *VM) executeSliceExpression(left, start, end object.Object) error {
+	var length int
+	switch left := left.(type) {
+	case *object.Array:
+		length = len(left.Elements)
+	case *object.String:
+		length = len(left.Value)
+	default:
+		return fmt.Errorf("slice operator not supported: %s", left.Type())
+	}
+	low, err := sliceBound(start, 0, length)
+	if err != nil {
+		return err
+	}
+	high, err := sliceBound(end, length, length)
+	if err != nil {
+		return err
+	}
+	if high < low {
+		high = low
+	}
+	switch left := left.(type) {
+	case *object.Array:
+		// arrays are mutable, so the slice gets its own copy
+		elements := make([]object.Object, high-low)
+		copy(elements, left.Elements[low:high])
+		return vm.push(&object.Array{Elements: elements})
+	default:
+		// strings are immutable, safe to share the underlying bytes
+		value := left.(*object.String).Value
+		return vm.push(&object.String{Value: value[low:high]})
+	}
+}
+
+// resolve a slice bound python-style: null means the default,
+// negative counts from the end, and out of range bounds are clamped
+func sliceBound(bound object.Object, def int, length int) (int, error) {
+	if bound == Null {
+		return def, nil
+	}
+	integer, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, fmt.Errorf("slice index must be INTEGER, got %s", bound.Type())
+	}
+	i := integer.Value
+	if i < 0 {
+		i += int64(length)
+	}
+	if i < 0 {
+		return 0, nil
+	}
+	if i > int64(length) {
+		return length, nil
+	}
+	return int(i), nil
+}
+
 func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
 	key, ok := index.(object.Hashable)
@@ -535,10 +1275,217 @@ func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	return vm.push(pair.Value)
 }
 
-func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+// obj.field reads like obj["field"], but a missing field is an error
+func (vm *VM) executeFieldExpression(left, name object.Object) error {
+	field := name.(*object.String)
+	if module, ok := left.(*object.Module); ok {
+		value, ok := module.Exports[field.Value]
+		if !ok {
+			return fmt.Errorf("%s is not exported by %s", field.Value, module.Name)
+		}
+		return vm.push(value)
+	}
+	if task, ok := left.(*object.Task); ok {
+		if field.Value != "await" {
+			return fmt.Errorf("task has no method %s", field.Value)
+		}
+		return vm.push(task.AwaitMethod())
+	}
+	if g, ok := left.(*object.Generator); ok {
+		switch field.Value {
+		case "next":
+			return vm.push(vm.generatorNext(g))
+		case "close":
+			return vm.push(generatorClose(g))
+		}
+		return fmt.Errorf("generator has no method %s", field.Value)
+	}
+	if enum, ok := left.(*object.Enum); ok {
+		value, ok := enum.Member(field.Value)
+		if !ok {
+			return fmt.Errorf("%s has no variant %s", enum.Name, field.Value)
+		}
+		return vm.push(value)
+	}
+	if variant, ok := left.(*object.Variant); ok {
+		value, ok := variant.Get(field.Value)
+		if !ok {
+			return fmt.Errorf("%s has no field %s", variant.VariantType.Inspect(), field.Value)
+		}
+		return vm.push(value)
+	}
+	if instance, ok := left.(*object.Instance); ok {
+		value, ok := instance.Get(field.Value)
+		if !ok {
+			return fmt.Errorf("%s has no field or method %s", instance.Class.Name, field.Value)
+		}
+		return vm.push(value)
+	}
+	if s, ok := left.(*object.Struct); ok {
+		value, ok := s.Get(field.Value)
+		if !ok {
+			return fmt.Errorf("%s has no field %s", s.StructType.Name, field.Value)
+		}
+		return vm.push(value)
+	}
+	hashObject, ok := left.(*object.Hash)
+	if !ok {
+		return fmt.Errorf("cannot access field %s on %s", field.Value, left.Type())
+	}
+	pair, ok := hashObject.Pairs[field.HashKey()]
+	if !ok {
+		return fmt.Errorf("field not found: %s", field.Value)
+	}
+	return vm.push(pair.Value)
+}
+
+// push the iterator's next values, or jump to pos when it's exhausted.
+// an error from a next method is raised here
+func (vm *VM) executeIterNext(iterator *object.Iterator, numValues int, pos int) error {
+	if numValues == 1 {
+		value, ok := iterator.NextValue()
+		if !ok {
+			return vm.iterEnd(iterator, pos)
+		}
+		return vm.push(value)
+	}
+
+	key, value, ok := iterator.Next()
+	if !ok {
+		return vm.iterEnd(iterator, pos)
+	}
+	err := vm.push(key)
+	if err != nil {
+		return err
+	}
+	return vm.push(value)
+}
+
+func (vm *VM) iterEnd(iterator *object.Iterator, pos int) error {
+	errObj := iterator.Err()
+	if errObj != nil {
+		return runtimeError(errObj)
+	}
+	vm.currentFrame().ip = pos - 1
+	return nil
+}
+
+// spread value into target, which is always a fresh array or hash
+// built by the compiler for a literal with spreads
+func (vm *VM) executeExtend(target, value object.Object) error {
+	switch target := target.(type) {
+	case *object.Array:
+		// [...xs] and f(...xs) take anything iterable
+		if array, ok := value.(*object.Array); ok {
+			target.Elements = append(target.Elements, array.Elements...)
+			return nil
+		}
+		iterator, errObj := vm.iterate(value)
+		if errObj != nil {
+			return fmt.Errorf("cannot spread %s, want an iterable", value.Type())
+		}
+		for el, ok := iterator.NextValue(); ok; el, ok = iterator.NextValue() {
+			target.Elements = append(target.Elements, el)
+		}
+		errObj = iterator.Err()
+		if errObj != nil {
+			return runtimeError(errObj)
+		}
+	case *object.Hash:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return fmt.Errorf("cannot spread %s, want HASH", value.Type())
+		}
+		for k, pair := range hash.Pairs {
+			target.Pairs[k] = pair
+		}
+	case *object.Set:
+		// #{...xs} takes anything iterable
+		iterator, errObj := vm.iterate(value)
+		if errObj != nil {
+			return fmt.Errorf("cannot spread %s, want an iterable", value.Type())
+		}
+		for el, ok := iterator.NextValue(); ok; el, ok = iterator.NextValue() {
+			err := target.Add(el)
+			if err != nil {
+				return err
+			}
+		}
+		errObj = iterator.Err()
+		if errObj != nil {
+			return runtimeError(errObj)
+		}
+	}
+	return nil
+}
+
+// obj.field = v, adds the field when it's missing
+func (vm *VM) executeSetField(left, name, value object.Object) error {
+	if instance, ok := left.(*object.Instance); ok {
+		field := name.(*object.String)
+		instance.Fields[field.Value] = value
+		return vm.push(value)
+	}
+	if s, ok := left.(*object.Struct); ok {
+		field := name.(*object.String)
+		if !s.Set(field.Value, value) {
+			return fmt.Errorf("%s has no field %s", s.StructType.Name, field.Value)
+		}
+		return vm.push(value)
+	}
+	if left.Type() != object.HASH_OBJ {
+		field := name.(*object.String)
+		return fmt.Errorf("cannot assign field %s on %s", field.Value, left.Type())
+	}
+	return vm.executeSetIndex(left, name, value)
+}
+
+// a[i] = v, updates the collection in place
+// and leaves the assigned value on the stack
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		integer, ok := index.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+		}
+		i := integer.Value
+		length := int64(len(left.Elements))
+		if i < 0 {
+			i += length
+		}
+		if i < 0 || i >= length {
+			return fmt.Errorf("index out of range: %d (array length %d)", integer.Value, length)
+		}
+		left.Elements[i] = value
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+	default:
+		return fmt.Errorf("index assignment not supported: %s", left.Type())
+	}
+	return vm.push(value)
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int, keywords []string) error {
+	if keywords != nil {
+		err := vm.bindKeywords(cl.Fn.Parameters, numArgs, keywords)
+		if err != nil {
+			return err
+		}
+	}
 	if numArgs != cl.Fn.NumParameters {
 		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
 	}
+	if cl.Fn.Generator {
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+		vm.sp = vm.sp - numArgs - 1
+		return vm.push(vm.newGenerator(cl, args))
+	}
 	basePointer := vm.sp - numArgs
 	frame := NewFrame(cl, basePointer)
 	vm.pushFrame(frame)
@@ -546,6 +1493,18 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 	return nil
 }
 
+// put the arguments on top of the stack in the order of params.
+// they're all bound once it's done, so there are as many as before
+func (vm *VM) bindKeywords(params []string, numArgs int, keywords []string) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+	bound, err := object.BindKeywords(params, args, keywords)
+	if err != nil {
+		return err
+	}
+	copy(args, bound)
+	return nil
+}
+
 func (vm *VM) pushClosure(constIndex int, numFree int) error {
 	constant := vm.constants[constIndex]
 	function, ok := constant.(*object.CompiledFunction)